@@ -5,6 +5,16 @@
 #include <avr/wdt.h>
 #include <RotaryEncoder.h>
 #include <OneButton.h>
+#include <EEPROM.h>
+
+// Firmware identification, reported to the host in reply to a capabilities request
+#define FIRMWARE_VERSION "1.1.0"
+#define DEVICE_ID_MAGIC 0xDE
+#define DEVICE_ID_ADDRESS 0
+
+// Input controls in the order they appear in slider lines (E = encoder, S = slider, B = button)
+#define CONFIG_CONTROLS "ESSS"
+#define CONFIG_NUM_DISPLAYS 4
 
 // Configuration constants
 #define CONFIG_NUM_SLIDERS 3
@@ -35,6 +45,23 @@
 #define CMD_MINUS '-'
 #define CMD_CARET '^'
 
+// Framed protocol (see pkg/deej/protocol.go for the host side)
+#define PROTOCOL_VERSION 1
+#define FRAME_START 0x02
+#define FRAME_TYPE_HELLO 0x01
+#define FRAME_TYPE_SLIDERS 0x02
+#define FRAME_TYPE_MASTER 0x03
+#define FRAME_TYPE_NAMES 0x04
+#define FRAME_TYPE_KEEPALIVE 0x05
+#define FRAME_TYPE_LOG 0x06
+#define FRAME_TYPE_CAPS 0x07
+#define FRAME_TYPE_ACK 0x08
+#define FRAME_MAX_PAYLOAD SERIAL_BUFFER_SIZE
+#define SLIDER_VALUE_EQUAL 0xF0
+#define SLIDER_VALUE_PLUS 0xF1
+#define SLIDER_VALUE_MINUS 0xF2
+#define SLIDER_VALUE_CARET 0xF3
+
 // Global variables
 Adafruit_SSD1306 display(DISPLAY_WIDTH, DISPLAY_HEIGHT, &Wire, DISPLAY_RESET_PIN);
 char outputBuffer[20];
@@ -43,6 +70,12 @@ char tempChars[SERIAL_BUFFER_SIZE];
 boolean newData = false;
 unsigned long keepAlive = 0;
 
+// set once the host asks for the framed protocol, until the next reset
+bool framedProtocol = false;
+
+// random, generated once and kept in EEPROM so the host can tell devices apart
+char deviceId[9];
+
 RotaryEncoder *encoder = nullptr;
 OneButton button(RE_SWITCH, true);
 
@@ -115,6 +148,7 @@ void setup() {
     
     Serial.begin(CONFIG_BAUD_RATE);
     state.init();
+    loadDeviceId();
     
     // Initialize analog readers
     for (int i = 0; i < CONFIG_NUM_SLIDERS; i++) {
@@ -131,9 +165,7 @@ void setup() {
     // Initialize displays
     for (int i = 0; i < 4; i++) {
         if (!initDisplay(i)) {
-            Serial.print(F("Display "));
-            Serial.print(i);
-            Serial.println(F(" initialization failed"));
+            logDisplayFailure(i);
         }
     }
 }
@@ -181,39 +213,94 @@ void handleEncoder() {
     static int pos = 0;
     int newPos = encoder->getPosition();
     if (pos != newPos) {
-        char command = (int)(encoder->getDirection()) > 0 ? '-' : '+';
-        sprintf(outputBuffer, "%c|%d|%d|%d", 
-              command,
-              state.analogSliderValues[0], 
-              state.analogSliderValues[1],
-              state.analogSliderValues[2]);
-        Serial.println(outputBuffer);
+        char command = (int)(encoder->getDirection()) > 0 ? CMD_MINUS : CMD_PLUS;
+        sendControls(command);
 
         pos = newPos;
     }
 }
 
 void RESwitchClicked() {
-    sprintf(outputBuffer, "^|%d|%d|%d", 
-            state.analogSliderValues[0], 
-            state.analogSliderValues[1],
-            state.analogSliderValues[2]);
+    sendControls(CMD_CARET);
+}
+
+// Sends the encoder command followed by all slider values, in whichever protocol the host asked for
+void sendControls(char command) {
+    if (framedProtocol) {
+        uint8_t payload[CONFIG_NUM_SLIDERS + 1];
+        switch (command) {
+            case CMD_PLUS:  payload[0] = SLIDER_VALUE_PLUS; break;
+            case CMD_MINUS: payload[0] = SLIDER_VALUE_MINUS; break;
+            case CMD_CARET: payload[0] = SLIDER_VALUE_CARET; break;
+            default:        payload[0] = SLIDER_VALUE_EQUAL; break;
+        }
+        for (int i = 0; i < CONFIG_NUM_SLIDERS; i++) {
+            payload[i + 1] = (uint8_t)state.analogSliderValues[i];
+        }
+        sendFrame(FRAME_TYPE_SLIDERS, payload, sizeof(payload));
+        return;
+    }
+
+    sprintf(outputBuffer, "%c|%d|%d|%d",
+        command,
+        state.analogSliderValues[0],
+        state.analogSliderValues[1],
+        state.analogSliderValues[2]);
     Serial.println(outputBuffer);
 }
 
+// Prints a diagnostic line, wrapping it in a log frame when speaking the framed protocol
+void logMessage(const char *message) {
+    if (framedProtocol) {
+        sendFrame(FRAME_TYPE_LOG, (const uint8_t *)message, strlen(message));
+    } else {
+        Serial.println(message);
+    }
+}
+
+void logMessage(const __FlashStringHelper *message) {
+    char buffer[48];
+    strncpy_P(buffer, (PGM_P)message, sizeof(buffer) - 1);
+    buffer[sizeof(buffer) - 1] = '\0';
+    logMessage(buffer);
+}
+
+uint16_t crc16(uint16_t crc, uint8_t data) {
+    crc ^= (uint16_t)data << 8;
+    for (int bit = 0; bit < 8; bit++) {
+        crc = (crc & 0x8000) ? (crc << 1) ^ 0x1021 : crc << 1;
+    }
+    return crc;
+}
+
+void sendFrame(uint8_t type, const uint8_t *payload, uint8_t length) {
+    uint8_t header[3] = { PROTOCOL_VERSION, type, length };
+    uint16_t crc = 0xFFFF;
+
+    Serial.write(FRAME_START);
+    for (int i = 0; i < 3; i++) {
+        Serial.write(header[i]);
+        crc = crc16(crc, header[i]);
+    }
+    for (int i = 0; i < length; i++) {
+        Serial.write(payload[i]);
+        crc = crc16(crc, payload[i]);
+    }
+    Serial.write((uint8_t)(crc >> 8));
+    Serial.write((uint8_t)(crc & 0xFF));
+}
+
 
 bool initDisplay(int displayId) {
     if (displayId >= 4) {
-        Serial.println(F("Error: Invalid display ID"));
+        logMessage(F("Error: Invalid display ID"));
         return false;
     }
 
     tcaselect(displayId);
     
     if (!display.begin(SSD1306_SWITCHCAPVCC, SCREEN_ADDRESS)) {
-        Serial.print(F("Display "));
-        Serial.print(displayId);
-        Serial.println(F(" initialization failed"));
+        logDisplayFailure(displayId);
         return false;
     }
     
@@ -222,6 +309,12 @@ bool initDisplay(int displayId) {
     return true;
 }
 
+void logDisplayFailure(int displayId) {
+    char message[32];
+    snprintf(message, sizeof(message), "Display %d initialization failed", displayId);
+    logMessage(message);
+}
+
 void updateDisplay(int displayId) {
     tcaselect(displayId);
     display.clearDisplay();
@@ -285,11 +378,7 @@ void updateSliderValues() {
 }
 
 void sendSliderValues() {
-    sprintf(outputBuffer, "=|%d|%d|%d", 
-        state.analogSliderValues[0], 
-        state.analogSliderValues[1],
-        state.analogSliderValues[2]);
-    Serial.println(outputBuffer);
+    sendControls(CMD_EQUAL);
 }
 
 void receiveWithStartEndMarkers() {
@@ -302,6 +391,10 @@ void receiveWithStartEndMarkers() {
     while (Serial.available() > 0 && newData == false) {
         rc = Serial.read();
 
+        if (receiveFrameByte(rc)) {
+            continue;
+        }
+
         if (recvInProgress == true) {
             if (rc != endMarker) {
                 receivedChars[ndx] = rc;
@@ -323,12 +416,182 @@ void receiveWithStartEndMarkers() {
     }
 }
 
+void loadDeviceId() {
+    if (EEPROM.read(DEVICE_ID_ADDRESS) != DEVICE_ID_MAGIC) {
+        randomSeed(analogRead(A7) ^ micros());
+        EEPROM.write(DEVICE_ID_ADDRESS, DEVICE_ID_MAGIC);
+        for (int i = 1; i <= 4; i++) {
+            EEPROM.write(DEVICE_ID_ADDRESS + i, (uint8_t)random(256));
+        }
+    }
+
+    snprintf(deviceId, sizeof(deviceId), "%02X%02X%02X%02X",
+        EEPROM.read(DEVICE_ID_ADDRESS + 1),
+        EEPROM.read(DEVICE_ID_ADDRESS + 2),
+        EEPROM.read(DEVICE_ID_ADDRESS + 3),
+        EEPROM.read(DEVICE_ID_ADDRESS + 4));
+}
+
+// Reports firmware version, device ID and hardware layout (see pkg/deej/capabilities.go for the host side)
+void sendCapabilities() {
+    char report[48];
+    snprintf(report, sizeof(report), "deejx|%s|%s|%s|%d",
+        FIRMWARE_VERSION, deviceId, CONFIG_CONTROLS, CONFIG_NUM_DISPLAYS);
+
+    if (framedProtocol) {
+        sendFrame(FRAME_TYPE_CAPS, (const uint8_t *)report, strlen(report));
+    } else {
+        Serial.print('@');
+        Serial.println(report);
+    }
+}
+
+// Confirms that a host message was applied, so the host doesn't send it again. Acks carry the checksum of the
+// message they confirm, so the host can tell them apart from acks for older messages of the same kind.
+// Text replies look like "&!3FA2", framed ones carry the type and CRC of the acknowledged frame
+void sendAck(char command, uint8_t frameType, uint16_t checksum) {
+    if (framedProtocol) {
+        uint8_t payload[3] = {frameType, (uint8_t)(checksum >> 8), (uint8_t)(checksum & 0xFF)};
+        sendFrame(FRAME_TYPE_ACK, payload, sizeof(payload));
+    } else {
+        char ack[7];
+        snprintf(ack, sizeof(ack), "&%c%04X", command, checksum);
+        Serial.println(ack);
+    }
+}
+
+// Checksum of a text host message as it was sent, including its start and end markers
+uint16_t textMessageChecksum(const char *message) {
+    uint16_t crc = crc16(0xFFFF, '<');
+    for (const char *c = message; *c != '\0'; c++) {
+        crc = crc16(crc, *c);
+    }
+    return crc16(crc, '>');
+}
+
+// Feeds a single received byte into the frame receiver. Returns true if the byte belonged to a frame
+bool receiveFrameByte(uint8_t rc) {
+    static bool inFrame = false;
+    static uint8_t header[3];
+    static uint8_t payload[FRAME_MAX_PAYLOAD + 1];
+    static uint8_t crcBytes[2];
+    static int ndx = 0;
+
+    if (!inFrame) {
+        if (rc != FRAME_START) {
+            return false;
+        }
+        inFrame = true;
+        ndx = 0;
+        return true;
+    }
+
+    if (ndx < 3) {
+        header[ndx++] = rc;
+        if (ndx == 3 && header[2] > FRAME_MAX_PAYLOAD) {
+            inFrame = false; // can't possibly be valid, resync on the next start byte
+        }
+        return true;
+    }
+
+    int length = header[2];
+    if (ndx < 3 + length) {
+        payload[ndx - 3] = rc;
+        ndx++;
+        return true;
+    }
+
+    crcBytes[ndx - 3 - length] = rc;
+    ndx++;
+    if (ndx < 3 + length + 2) {
+        return true;
+    }
+
+    inFrame = false;
+
+    uint16_t crc = 0xFFFF;
+    for (int i = 0; i < 3; i++) {
+        crc = crc16(crc, header[i]);
+    }
+    for (int i = 0; i < length; i++) {
+        crc = crc16(crc, payload[i]);
+    }
+    if (crc != (((uint16_t)crcBytes[0] << 8) | crcBytes[1]) || header[0] != PROTOCOL_VERSION) {
+        logMessage(F("Error: Dropped invalid frame"));
+        return true;
+    }
+
+    payload[length] = '\0';
+    handleFrame(header[1], payload, length, crc);
+    return true;
+}
+
+void handleFrame(uint8_t type, uint8_t *payload, int length, uint16_t crc) {
+    switch (type) {
+        case FRAME_TYPE_MASTER:
+            if (length < 2) {
+                logMessage(F("Error: Invalid mute command format"));
+                return;
+            }
+            applyMasterState(payload[0], payload[1]);
+            sendAck('!', FRAME_TYPE_MASTER, crc);
+            break;
+        case FRAME_TYPE_NAMES:
+            applySliderNames((char *)payload);
+            sendAck('^', FRAME_TYPE_NAMES, crc);
+            break;
+        case FRAME_TYPE_KEEPALIVE:
+            applyKeepAlive();
+            sendAck('#', FRAME_TYPE_KEEPALIVE, crc);
+            break;
+        case FRAME_TYPE_CAPS:
+            sendCapabilities();
+            break;
+        default:
+            logMessage(F("Unknown command"));
+            break;
+    }
+}
+
+void applyMasterState(int newMute, int newVolume) {
+    state.mute = constrain(newMute, 0, 1);
+    state.masterVolume = constrain(newVolume, 0, 100);
+    state.dataChanged = true;
+}
+
+void applySliderNames(char *data) {
+    int i = 0;
+    char *token = strtok(data, "|");
+    while (token != NULL && i < MAX_SLIDERS) {
+        size_t tokenLen = strlen(token);
+        size_t copyLen = min(tokenLen, (size_t)SLIDER_NAME_LENGTH - 1);
+        memcpy(state.sliderNames[i], token, copyLen);
+        state.sliderNames[i][copyLen] = '\0';
+        i++;
+        token = strtok(NULL, "|");
+    }
+    state.dataChanged = true;
+    logMessage(F("Parsed name list"));
+}
+
+void applyKeepAlive() {
+    keepAlive = millis();
+    if (!state.screensActive) {
+        state.screensActive = true;
+        state.dataChanged = true;
+    }
+    logMessage(F("Keep-alive signal received"));
+}
+
 void parseReceivedData() {
     if (strlen(tempChars) < 1) {
-        Serial.println(F("Error: Empty command received"));
+        logMessage(F("Error: Empty command received"));
         return;
     }
 
+    // before the data gets split up below
+    uint16_t checksum = textMessageChecksum(tempChars);
+
     char command = tempChars[0];
     char* data = tempChars + 1;
 
@@ -336,54 +599,49 @@ void parseReceivedData() {
         case '!': {
             char *token = strtok(data, "|");
             if (token == NULL) {
-                Serial.println(F("Error: Invalid mute command format"));
+                logMessage(F("Error: Invalid mute command format"));
                 return;
             }
             
-            int newMute = constrain(atoi(token), 0, 1);
+            int newMute = atoi(token);
             
             token = strtok(NULL, "|");
             if (token == NULL) {
-                Serial.println(F("Error: Invalid volume command format"));
+                logMessage(F("Error: Invalid volume command format"));
                 return;
             }
             
-            int newVolume = constrain(atoi(token), 0, 100);
-            
-            state.mute = newMute;
-            state.masterVolume = newVolume;
-            state.dataChanged = true;
+            applyMasterState(newMute, atoi(token));
+            sendAck('!', FRAME_TYPE_MASTER, checksum);
             break;
         }
 
-        case '^': {
-            int i = 0;
-            char *token = strtok(data, "|");
-            while (token != NULL && i < MAX_SLIDERS) {
-                size_t tokenLen = strlen(token);
-                size_t copyLen = min(tokenLen, (size_t)SLIDER_NAME_LENGTH - 1);
-                memcpy(state.sliderNames[i], token, copyLen);
-                state.sliderNames[i][copyLen] = '\0';
-                i++;
-                token = strtok(NULL, "|");
-            }
-            state.dataChanged = true;
-            Serial.println(F("Parsed name list"));
+        case '^':
+            applySliderNames(data);
+            sendAck('^', FRAME_TYPE_NAMES, checksum);
+            break;
+
+        case '#':
+            applyKeepAlive();
+            sendAck('#', FRAME_TYPE_KEEPALIVE, checksum);
+            break;
+
+        case '?':
+            sendCapabilities();
             break;
-        }
 
-        case '#': {
-            keepAlive = millis();
-            if (!state.screensActive) {
-                state.screensActive = true;
-                state.dataChanged = true;
+        case '~': {
+            // the host is asking for the framed protocol - agree if we speak its version
+            if (atoi(data) == PROTOCOL_VERSION) {
+                framedProtocol = true;
+                uint8_t version = PROTOCOL_VERSION;
+                sendFrame(FRAME_TYPE_HELLO, &version, 1);
             }
-            Serial.println(F("Keep-alive signal received"));
             break;
         }
 
         default:
-            Serial.println(F("Unknown command"));
+            logMessage(F("Unknown command"));
             break;
     }
 }
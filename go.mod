@@ -14,7 +14,9 @@ require (
 	github.com/moutend/go-wca v0.3.0
 	github.com/spf13/viper v1.17.0
 	github.com/thoas/go-funk v0.9.3
+	go.bug.st/serial v1.6.4
 	go.uber.org/zap v1.27.0
+	golang.org/x/sys v0.19.0
 )
 
 require (
@@ -42,10 +44,8 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/subosito/gotenv v1.6.0 // indirect
 	github.com/tadvi/systray v0.0.0-20190226123456-11a2b8fa57af // indirect
-	go.bug.st/serial v1.6.4 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 	golang.org/x/exp v0.0.0-20230905200255-921286631fa9 // indirect
-	golang.org/x/sys v0.19.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
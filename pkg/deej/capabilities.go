@@ -0,0 +1,106 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DeviceCapabilities describes a device's hardware layout and firmware, as reported by the device itself
+// in reply to a capabilities request. The text format reply looks like this:
+//
+//	@deejx|<firmware version>|<unique id>|<input controls>|<display count>
+//
+// e.g. "@deejx|1.1.0|4F2A91C0|ESSS|4". input controls are listed one letter per control, in the same order
+// as the fields of the device's slider lines. the framed format carries the same text (minus the '@') in a
+// capabilities frame
+type DeviceCapabilities struct {
+	Firmware string
+	DeviceID string
+
+	// indexed like the fields of the device's slider lines (and therefore like slider_mapping)
+	Controls []ControlKind
+	Displays int
+}
+
+// ControlKind identifies the type of a single input control on the device
+type ControlKind byte
+
+// The input control kinds a device can report
+const (
+	ControlSlider  ControlKind = 'S'
+	ControlEncoder ControlKind = 'E'
+	ControlButton  ControlKind = 'B'
+)
+
+const (
+	capabilitiesRequest    = "<?>"
+	capabilitiesLinePrefix = "@"
+	capabilitiesFamily     = "deejx"
+	capabilitiesFieldCount = 5
+)
+
+func parseCapabilities(text string) (DeviceCapabilities, error) {
+	text = strings.TrimPrefix(strings.TrimSpace(text), capabilitiesLinePrefix)
+	fields := strings.Split(text, "|")
+
+	if len(fields) != capabilitiesFieldCount || fields[0] != capabilitiesFamily {
+		return DeviceCapabilities{}, fmt.Errorf("capabilities: malformed report %q", text)
+	}
+
+	caps := DeviceCapabilities{
+		Firmware: fields[1],
+		DeviceID: fields[2],
+	}
+
+	for idx, kind := range []byte(fields[3]) {
+		switch ControlKind(kind) {
+		case ControlSlider, ControlEncoder, ControlButton:
+			caps.Controls = append(caps.Controls, ControlKind(kind))
+		default:
+			return DeviceCapabilities{}, fmt.Errorf("capabilities: unknown control kind %q at index %d", kind, idx)
+		}
+	}
+
+	displays, err := strconv.Atoi(fields[4])
+	if err != nil || displays < 0 {
+		return DeviceCapabilities{}, fmt.Errorf("capabilities: invalid display count %q", fields[4])
+	}
+
+	caps.Displays = displays
+
+	return caps, nil
+}
+
+// Count returns how many input controls of the given kind the device has
+func (dc DeviceCapabilities) Count(kind ControlKind) int {
+	count := 0
+
+	for _, control := range dc.Controls {
+		if control == kind {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (dc DeviceCapabilities) String() string {
+	return fmt.Sprintf("<firmware %s, id %s, %d sliders, %d encoders, %d buttons, %d displays>",
+		dc.Firmware, dc.DeviceID,
+		dc.Count(ControlSlider), dc.Count(ControlEncoder), dc.Count(ControlButton),
+		dc.Displays)
+}
+
+func (k ControlKind) String() string {
+	switch k {
+	case ControlSlider:
+		return "slider"
+	case ControlEncoder:
+		return "encoder"
+	case ControlButton:
+		return "button"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,56 @@
+package deej
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    DeviceCapabilities
+		wantErr bool
+	}{
+		{
+			name: "text reply",
+			text: "@deejx|1.1.0|4F2A91C0|ESSB|4\r\n",
+			want: DeviceCapabilities{
+				Firmware: "1.1.0",
+				DeviceID: "4F2A91C0",
+				Controls: []ControlKind{ControlEncoder, ControlSlider, ControlSlider, ControlButton},
+				Displays: 4,
+			},
+		},
+		{
+			name: "frame payload, without the prefix",
+			text: "deejx|2.0.0|AB|S|0",
+			want: DeviceCapabilities{
+				Firmware: "2.0.0",
+				DeviceID: "AB",
+				Controls: []ControlKind{ControlSlider},
+				Displays: 0,
+			},
+		},
+		{name: "another family", text: "@other|1.1.0|4F2A91C0|S|4", wantErr: true},
+		{name: "missing field", text: "@deejx|1.1.0|S|4", wantErr: true},
+		{name: "unknown control kind", text: "@deejx|1.1.0|4F2A91C0|SX|4", wantErr: true},
+		{name: "negative display count", text: "@deejx|1.1.0|4F2A91C0|S|-1", wantErr: true},
+		{name: "non-numeric display count", text: "@deejx|1.1.0|4F2A91C0|S|four", wantErr: true},
+		{name: "slider line", text: "=|50|20|100", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCapabilities(tt.text)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCapabilities(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCapabilities(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
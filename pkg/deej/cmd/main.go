@@ -13,11 +13,25 @@ var (
 	buildType  string
 
 	verbose bool
+
+	record      bool
+	replayPath  string
+	replaySpeed float64
+	simulate    bool
+
+	dryRun       bool
+	dryRunScript string
 )
 
 func init() {
 	flag.BoolVar(&verbose, "verbose", false, "show verbose logs (useful for debugging serial)")
 	flag.BoolVar(&verbose, "v", false, "shorthand for --verbose")
+	flag.BoolVar(&record, "record", false, "record all device traffic to files in the logs directory")
+	flag.StringVar(&replayPath, "replay", "", "play back the given recording instead of connecting to its device")
+	flag.Float64Var(&replaySpeed, "replay-speed", 1, "replay speed multiplier (0 replays without any delays)")
+	flag.BoolVar(&simulate, "simulate", false, "connect to a simulated mixer instead of actual hardware (Linux only)")
+	flag.BoolVar(&dryRun, "dry-run", false, "use in-memory audio sessions and log volume changes instead of making them")
+	flag.StringVar(&dryRunScript, "dry-run-script", "", "script apps appearing, disappearing and failing during a dry run")
 	flag.Parse()
 }
 
@@ -48,6 +62,28 @@ func main() {
 		named.Fatalw("Failed to create deej object", "error", err)
 	}
 
+	if record {
+		d.EnableRecording()
+	}
+
+	if replayPath != "" {
+		if err := d.SetReplay(deej.ReplayOptions{Path: replayPath, Speed: replaySpeed}); err != nil {
+			named.Fatalw("Failed to set up replay", "error", err)
+		}
+	}
+
+	if simulate {
+		if err := d.EnableSimulation(); err != nil {
+			named.Fatalw("Failed to set up simulated mixer", "error", err)
+		}
+	}
+
+	if dryRun || dryRunScript != "" {
+		if err := d.EnableDryRun(deej.DryRunOptions{ScriptPath: dryRunScript}); err != nil {
+			named.Fatalw("Failed to set up dry run", "error", err)
+		}
+	}
+
 	// if injected by build process, set version info to show up in the tray
 	if buildType != "" && (versionTag != "" || gitCommit != "") {
 		identifier := gitCommit
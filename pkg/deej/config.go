@@ -3,12 +3,14 @@ package deej
 import (
 	"fmt"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+	"github.com/thoas/go-funk"
 	"go.uber.org/zap"
 
 	"github.com/omriharel/deej/pkg/deej/util"
@@ -17,21 +19,22 @@ import (
 // CanonicalConfig provides application-wide access to configuration fields,
 // as well as loading/file watching logic for deej's configuration file
 type CanonicalConfig struct {
-	SliderMapping   *sliderMap
-	IgnoreUnmapped  []string
-	SliderMaxVolume map[int]int // Add this field to store max volume per slider
-
-	ConnectionInfo struct {
-		COMPort  string
-		BaudRate int
-	}
+	// the default device first, followed by any additional devices
+	Devices []*DeviceConfig
 
-	SliderNames string
+	IgnoreUnmapped []string
 
 	InvertSliders bool
 
 	NoiseReductionLevel string
 
+	// which sound server to talk to on Linux. PulseAudio is also the fallback for when PipeWire isn't available
+	AudioBackend string
+
+	// the devices that the deej.cycle_output and deej.cycle_input targets switch between, in order
+	CycleOutputDevices []string
+	CycleInputDevices  []string
+
 	logger             *zap.SugaredLogger
 	notifier           Notifier
 	stopWatcherChannel chan bool
@@ -42,6 +45,43 @@ type CanonicalConfig struct {
 	internalConfig *viper.Viper
 }
 
+// DeviceConfig holds everything that's configured separately for each connected device
+type DeviceConfig struct {
+	Name string
+
+	ConnectionInfo ConnectionInfo
+
+	SliderMapping   *sliderMap
+	SliderMaxVolume map[int]int // Add this field to store max volume per slider
+	SliderNames     string
+
+	// sliders without their own filter config use the device's noise reduction preset
+	NoiseReduction SliderFilterConfig
+	SliderFilters  map[int]SliderFilterConfig
+
+	// sliders without their own curve follow the cubic curve, up to their max volume
+	SliderCurves map[int]VolumeCurve
+
+	// the sinks each slider's button sends its apps to, in turn
+	SliderRoutes map[int][]SliderRoute
+}
+
+// ConnectionInfo describes how to reach a deej device
+type ConnectionInfo struct {
+	Transport string
+
+	COMPort  string
+	BaudRate int
+
+	// only used when COMPort is "auto", to narrow down which USB devices to probe ("VID:PID")
+	USBIDs []string
+
+	TCPAddress string
+	PTYLink    string
+
+	Protocol string
+}
+
 const (
 	userConfigFilepath     = "config.yaml"
 	internalConfigFilepath = "preferences.yaml"
@@ -60,11 +100,28 @@ const (
 	configKeyInvertSliders       = "invert_sliders"
 	configKeyCOMPort             = "com_port"
 	configKeyBaudRate            = "baud_rate"
+	configKeyUSBIDs              = "usb_ids"
+	configKeyTransport           = "transport"
+	configKeyTCPAddress          = "tcp_address"
+	configKeyPTYLink             = "pty_link"
+	configKeyProtocol            = "protocol"
 	configKeyNoiseReductionLevel = "noise_reduction"
 	configKeySliderMaxVolume     = "slider_max_volume"
+	configKeyDevices             = "devices"
+	configKeyAudioBackend        = "audio_backend"
+	configKeyCycleOutputDevices  = "cycle_output_devices"
+	configKeyCycleInputDevices   = "cycle_input_devices"
+
+	// the device described by the top level of the config file
+	defaultDeviceName = "default"
 
-	defaultCOMPort  = "COM4"
-	defaultBaudRate = 9600
+	defaultCOMPort   = "COM4"
+	defaultBaudRate  = 9600
+	defaultTransport = transportSerial
+	defaultProtocol  = protocolAuto
+
+	audioBackendPulseAudio = "pulseaudio"
+	audioBackendPipeWire   = "pipewire"
 )
 
 // has to be defined as a non-constant because we're using path.Join
@@ -94,11 +151,9 @@ func NewConfig(logger *zap.SugaredLogger, notifier Notifier) (*CanonicalConfig,
 	userConfig.SetConfigType(configType)
 	userConfig.AddConfigPath(userConfigPath)
 
-	userConfig.SetDefault(configKeySliderMapping, map[string][]string{})
-	userConfig.SetDefault(configKeySliderNames, "")
 	userConfig.SetDefault(configKeyInvertSliders, false)
-	userConfig.SetDefault(configKeyCOMPort, defaultCOMPort)
-	userConfig.SetDefault(configKeyBaudRate, defaultBaudRate)
+	userConfig.SetDefault(configKeyAudioBackend, audioBackendPulseAudio)
+	setDeviceDefaults(userConfig)
 
 	internalConfig := viper.New()
 	internalConfig.SetConfigName(internalConfigName)
@@ -113,6 +168,17 @@ func NewConfig(logger *zap.SugaredLogger, notifier Notifier) (*CanonicalConfig,
 	return cc, nil
 }
 
+// setDeviceDefaults sets the defaults of every device-specific key. it's needed for each device's section separately,
+// since viper doesn't carry defaults over to sub-trees
+func setDeviceDefaults(v *viper.Viper) {
+	v.SetDefault(configKeySliderMapping, map[string][]string{})
+	v.SetDefault(configKeySliderNames, "")
+	v.SetDefault(configKeyCOMPort, defaultCOMPort)
+	v.SetDefault(configKeyBaudRate, defaultBaudRate)
+	v.SetDefault(configKeyTransport, defaultTransport)
+	v.SetDefault(configKeyProtocol, defaultProtocol)
+}
+
 // Load reads deej's config files from disk and tries to parse them
 func (cc *CanonicalConfig) Load() error {
 	cc.logger.Debugw("Loading config", "path", userConfigFilepath)
@@ -153,10 +219,14 @@ func (cc *CanonicalConfig) Load() error {
 	}
 
 	cc.logger.Info("Loaded config successfully")
-	cc.logger.Infow("Config values",
-		"sliderMapping", cc.SliderMapping,
-		"connectionInfo", cc.ConnectionInfo,
-		"invertSliders", cc.InvertSliders)
+	for _, device := range cc.Devices {
+		cc.logger.Infow("Device config values",
+			"device", device.Name,
+			"sliderMapping", device.SliderMapping,
+			"connectionInfo", device.ConnectionInfo)
+	}
+
+	cc.logger.Infow("Config values", "invertSliders", cc.InvertSliders)
 
 	return nil
 }
@@ -227,44 +297,121 @@ func (cc *CanonicalConfig) StopWatchingConfigFile() {
 
 func (cc *CanonicalConfig) populateFromVipers() error {
 
-	// merge the slider mappings from the user and internal configs
-	cc.SliderMapping = sliderMapFromConfigs(
+	// the top level of the config describes the default device. the internal config's slider mappings only apply to it
+	defaultDevice := cc.populateDeviceFromViper(defaultDeviceName, cc.userConfig)
+	defaultDevice.SliderMapping = sliderMapFromConfigs(
 		cc.userConfig.GetStringMapStringSlice(configKeySliderMapping),
 		cc.internalConfig.GetStringMapStringSlice(configKeySliderMapping),
 	)
 
+	cc.Devices = []*DeviceConfig{defaultDevice}
+
+	// any additional devices have their own sections under "devices", sorted by name to keep their order stable
+	additionalDeviceNames := []string{}
+	for deviceName := range cc.userConfig.GetStringMap(configKeyDevices) {
+		additionalDeviceNames = append(additionalDeviceNames, deviceName)
+	}
+
+	sort.Strings(additionalDeviceNames)
+
+	for _, deviceName := range additionalDeviceNames {
+		deviceConfig := cc.userConfig.Sub(fmt.Sprintf("%s.%s", configKeyDevices, deviceName))
+		if deviceName == defaultDeviceName || deviceConfig == nil {
+			cc.logger.Warnw("Invalid device section, ignoring", "key", configKeyDevices, "device", deviceName)
+			continue
+		}
+
+		setDeviceDefaults(deviceConfig)
+		device := cc.populateDeviceFromViper(deviceName, deviceConfig)
+		device.SliderMapping = sliderMapFromConfigs(deviceConfig.GetStringMapStringSlice(configKeySliderMapping), nil)
+
+		cc.Devices = append(cc.Devices, device)
+	}
+
 	cc.IgnoreUnmapped = cc.userConfig.GetStringSlice(configKeyIgnoreUnmapped)
+	cc.InvertSliders = cc.userConfig.GetBool(configKeyInvertSliders)
+	cc.NoiseReductionLevel = cc.userConfig.GetString(configKeyNoiseReductionLevel)
+	cc.CycleOutputDevices = cc.userConfig.GetStringSlice(configKeyCycleOutputDevices)
+	cc.CycleInputDevices = cc.userConfig.GetStringSlice(configKeyCycleInputDevices)
+
+	cc.AudioBackend = strings.ToLower(cc.userConfig.GetString(configKeyAudioBackend))
+	if cc.AudioBackend != audioBackendPulseAudio && cc.AudioBackend != audioBackendPipeWire {
+		cc.logger.Warnw("Invalid audio backend specified, using default value",
+			"key", configKeyAudioBackend,
+			"invalidValue", cc.AudioBackend,
+			"defaultValue", audioBackendPulseAudio)
+
+		cc.AudioBackend = audioBackendPulseAudio
+	}
+
+	cc.logger.Debug("Populated config fields from vipers")
+
+	return nil
+}
+
+// populateDeviceFromViper reads everything that's specific to a single device (other than its slider mapping,
+// which is merged differently for the default device) from the given viper instance
+func (cc *CanonicalConfig) populateDeviceFromViper(deviceName string, v *viper.Viper) *DeviceConfig {
+	device := &DeviceConfig{Name: deviceName}
+	logger := cc.logger.With("device", deviceName)
 
 	// get the rest of the config fields - viper saves us a lot of effort here
-	cc.ConnectionInfo.COMPort = cc.userConfig.GetString(configKeyCOMPort)
-	if cc.ConnectionInfo.COMPort == "" {
-		cc.logger.Warnw("Empty COM port specified, using default value",
+	device.ConnectionInfo.Transport = strings.ToLower(v.GetString(configKeyTransport))
+	if !funk.ContainsString([]string{transportSerial, transportPTY, transportTCP, transportStdin}, device.ConnectionInfo.Transport) {
+		logger.Warnw("Invalid transport specified, using default value",
+			"key", configKeyTransport,
+			"invalidValue", device.ConnectionInfo.Transport,
+			"defaultValue", defaultTransport)
+
+		device.ConnectionInfo.Transport = defaultTransport
+	}
+
+	device.ConnectionInfo.TCPAddress = v.GetString(configKeyTCPAddress)
+	device.ConnectionInfo.PTYLink = v.GetString(configKeyPTYLink)
+
+	device.ConnectionInfo.Protocol = strings.ToLower(v.GetString(configKeyProtocol))
+	if device.ConnectionInfo.Protocol != protocolAuto && device.ConnectionInfo.Protocol != protocolText {
+		logger.Warnw("Invalid protocol specified, using default value",
+			"key", configKeyProtocol,
+			"invalidValue", device.ConnectionInfo.Protocol,
+			"defaultValue", defaultProtocol)
+
+		device.ConnectionInfo.Protocol = defaultProtocol
+	}
+
+	device.ConnectionInfo.COMPort = v.GetString(configKeyCOMPort)
+	if device.ConnectionInfo.COMPort == "" {
+		logger.Warnw("Empty COM port specified, using default value",
 			"key", configKeyCOMPort,
 			"defaultValue", defaultCOMPort)
-		cc.ConnectionInfo.COMPort = defaultCOMPort
+		device.ConnectionInfo.COMPort = defaultCOMPort
 	}
 
-	cc.ConnectionInfo.BaudRate = cc.userConfig.GetInt(configKeyBaudRate)
-	if cc.ConnectionInfo.BaudRate <= 0 {
-		cc.logger.Warnw("Invalid baud rate specified, using default value",
+	device.ConnectionInfo.USBIDs = v.GetStringSlice(configKeyUSBIDs)
+
+	device.ConnectionInfo.BaudRate = v.GetInt(configKeyBaudRate)
+	if device.ConnectionInfo.BaudRate <= 0 {
+		logger.Warnw("Invalid baud rate specified, using default value",
 			"key", configKeyBaudRate,
-			"invalidValue", cc.ConnectionInfo.BaudRate,
+			"invalidValue", device.ConnectionInfo.BaudRate,
 			"defaultValue", defaultBaudRate)
 
-		cc.ConnectionInfo.BaudRate = defaultBaudRate
+		device.ConnectionInfo.BaudRate = defaultBaudRate
 	}
 
-	cc.logger.Debugw("Populated connection info",
-		"comPort", cc.ConnectionInfo.COMPort,
-		"baudRate", cc.ConnectionInfo.BaudRate)
+	logger.Debugw("Populated connection info",
+		"transport", device.ConnectionInfo.Transport,
+		"comPort", device.ConnectionInfo.COMPort,
+		"usbIDs", device.ConnectionInfo.USBIDs,
+		"baudRate", device.ConnectionInfo.BaudRate)
 
 	// Check if slider_names is a string or a map
-	if cc.userConfig.IsSet(configKeySliderNames) && cc.userConfig.GetString(configKeySliderNames) != "" {
+	if v.IsSet(configKeySliderNames) && v.GetString(configKeySliderNames) != "" {
 		// Old format: slider_names is a string
-		cc.SliderNames = cc.userConfig.GetString(configKeySliderNames)
-	} else if cc.userConfig.IsSet(configKeySliderNamesMap) {
+		device.SliderNames = v.GetString(configKeySliderNames)
+	} else if v.IsSet(configKeySliderNamesMap) {
 		// New format: slider_names is a map
-		sliderNamesMap := cc.userConfig.GetStringMapString(configKeySliderNamesMap)
+		sliderNamesMap := v.GetStringMapString(configKeySliderNamesMap)
 
 		// Create a slice to hold names in order
 		maxSliderIdx := -1
@@ -285,25 +432,22 @@ func (cc *CanonicalConfig) populateFromVipers() error {
 		}
 
 		// Join the names with pipe separator
-		cc.SliderNames = strings.Join(sliderNames, "|")
+		device.SliderNames = strings.Join(sliderNames, "|")
 	}
 
-	cc.InvertSliders = cc.userConfig.GetBool(configKeyInvertSliders)
-	cc.NoiseReductionLevel = cc.userConfig.GetString(configKeyNoiseReductionLevel)
-
 	// Initialize the SliderMaxVolume map
-	cc.SliderMaxVolume = make(map[int]int)
+	device.SliderMaxVolume = make(map[int]int)
 
 	// Check if slider_max_volume is set in the config
-	if cc.userConfig.IsSet(configKeySliderMaxVolume) {
+	if v.IsSet(configKeySliderMaxVolume) {
 		// Get the map from the config
-		maxVolumeMap := cc.userConfig.GetStringMap(configKeySliderMaxVolume)
+		maxVolumeMap := v.GetStringMap(configKeySliderMaxVolume)
 
 		// Convert the map keys to integers and populate our SliderMaxVolume map
 		for sliderIdxStr, maxVolumeValue := range maxVolumeMap {
 			sliderIdx, err := strconv.Atoi(sliderIdxStr)
 			if err != nil {
-				cc.logger.Warnw("Invalid slider index in slider_max_volume",
+				logger.Warnw("Invalid slider index in slider_max_volume",
 					"index", sliderIdxStr, "error", err)
 				continue
 			}
@@ -319,34 +463,147 @@ func (cc *CanonicalConfig) populateFromVipers() error {
 			case string:
 				parsedValue, err := strconv.Atoi(v)
 				if err != nil {
-					cc.logger.Warnw("Invalid max volume value",
+					logger.Warnw("Invalid max volume value",
 						"slider", sliderIdx, "value", v, "error", err)
 					continue
 				}
 				maxVolume = parsedValue
 			default:
-				cc.logger.Warnw("Unsupported max volume value type",
+				logger.Warnw("Unsupported max volume value type",
 					"slider", sliderIdx, "type", fmt.Sprintf("%T", v))
 				continue
 			}
 
 			// Ensure the max volume is between 1 and 100
 			if maxVolume < 1 {
-				cc.logger.Warnw("Max volume too low, setting to 1", "slider", sliderIdx)
+				logger.Warnw("Max volume too low, setting to 1", "slider", sliderIdx)
 				maxVolume = 1
 			} else if maxVolume > 100 {
-				cc.logger.Warnw("Max volume too high, setting to 100", "slider", sliderIdx)
+				logger.Warnw("Max volume too high, setting to 100", "slider", sliderIdx)
 				maxVolume = 100
 			}
 
-			cc.SliderMaxVolume[sliderIdx] = maxVolume
-			cc.logger.Debugw("Set max volume for slider", "slider", sliderIdx, "maxVolume", maxVolume)
+			device.SliderMaxVolume[sliderIdx] = maxVolume
+			logger.Debugw("Set max volume for slider", "slider", sliderIdx, "maxVolume", maxVolume)
 		}
 	}
 
-	cc.logger.Debug("Populated config fields from vipers")
+	device.NoiseReduction, device.SliderFilters = cc.populateSliderFiltersFromViper(logger, v)
+	device.SliderCurves = populateSliderCurvesFromViper(logger, v, device)
+	device.SliderRoutes = populateSliderRoutesFromViper(logger, v)
 
-	return nil
+	return device
+}
+
+// populateSliderFiltersFromViper reads a device's noise reduction preset, which devices other than the default
+// one inherit from the top level unless they set their own, and its per-slider filter configs
+func (cc *CanonicalConfig) populateSliderFiltersFromViper(
+	logger *zap.SugaredLogger,
+	v *viper.Viper,
+) (SliderFilterConfig, map[int]SliderFilterConfig) {
+	level := v.GetString(configKeyNoiseReductionLevel)
+	if level == "" {
+		level = cc.userConfig.GetString(configKeyNoiseReductionLevel)
+	}
+
+	noiseReduction, ok := sliderFilterPreset(level)
+	if !ok && level != "" {
+		logger.Warnw("Invalid noise reduction level specified, using default value",
+			"key", configKeyNoiseReductionLevel,
+			"invalidValue", level,
+			"defaultValue", noiseReductionDefault)
+	}
+
+	sliderFilters := make(map[int]SliderFilterConfig)
+
+	for sliderIdxStr, value := range v.GetStringMap(configKeySliderFilters) {
+		sliderIdx, err := strconv.Atoi(sliderIdxStr)
+		if err != nil {
+			logger.Warnw("Invalid slider index in slider_filters", "index", sliderIdxStr, "error", err)
+			continue
+		}
+
+		filter, err := parseSliderFilterConfig(value, noiseReduction)
+		if err != nil {
+			logger.Warnw("Invalid slider filter config, using noise reduction preset",
+				"slider", sliderIdx, "error", err)
+			continue
+		}
+
+		sliderFilters[sliderIdx] = filter
+		logger.Debugw("Set filters for slider", "slider", sliderIdx, "filters", filter)
+	}
+
+	return noiseReduction, sliderFilters
+}
+
+// populateSliderCurvesFromViper reads a device's per-slider volume curves. slider_max_volume is the default
+// max of a slider's curve
+func populateSliderCurvesFromViper(logger *zap.SugaredLogger, v *viper.Viper, device *DeviceConfig) map[int]VolumeCurve {
+	sliderCurves := make(map[int]VolumeCurve)
+
+	for sliderIdxStr, value := range v.GetStringMap(configKeySliderCurves) {
+		sliderIdx, err := strconv.Atoi(sliderIdxStr)
+		if err != nil {
+			logger.Warnw("Invalid slider index in slider_curves", "index", sliderIdxStr, "error", err)
+			continue
+		}
+
+		curve, err := parseVolumeCurve(value, device.SliderCurve(sliderIdx))
+		if err != nil {
+			logger.Warnw("Invalid slider curve config, using the default curve", "slider", sliderIdx, "error", err)
+			continue
+		}
+
+		sliderCurves[sliderIdx] = curve
+		logger.Debugw("Set volume curve for slider", "slider", sliderIdx, "curve", curve)
+	}
+
+	return sliderCurves
+}
+
+// SliderCurve returns the volume curve of the given slider
+func (dc *DeviceConfig) SliderCurve(sliderIdx int) VolumeCurve {
+	if curve, ok := dc.SliderCurves[sliderIdx]; ok {
+		return curve
+	}
+
+	maxVolume := float32(1)
+	if percent, ok := dc.SliderMaxVolume[sliderIdx]; ok {
+		maxVolume = float32(percent) / 100
+	}
+
+	return defaultVolumeCurve(maxVolume)
+}
+
+// SliderFilter returns the filter config of the given slider
+func (dc *DeviceConfig) SliderFilter(sliderIdx int) SliderFilterConfig {
+	if filter, ok := dc.SliderFilters[sliderIdx]; ok {
+		return filter
+	}
+
+	return dc.NoiseReduction
+}
+
+// Device returns the configuration of the device with the given name
+func (cc *CanonicalConfig) Device(name string) (*DeviceConfig, bool) {
+	for _, device := range cc.Devices {
+		if device.Name == name {
+			return device, true
+		}
+	}
+
+	return nil, false
+}
+
+// DeviceNames returns the names of all configured devices, the default device first
+func (cc *CanonicalConfig) DeviceNames() []string {
+	names := make([]string, len(cc.Devices))
+	for idx, device := range cc.Devices {
+		names[idx] = device.Name
+	}
+
+	return names
 }
 
 func (cc *CanonicalConfig) onConfigReloaded() {
@@ -5,6 +5,7 @@ package deej
 import (
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -23,10 +24,18 @@ type Deej struct {
 	logger   *zap.SugaredLogger
 	notifier Notifier
 	config   *CanonicalConfig
-	serial   *SerialIO
+	devices  []*SerialIO // one for each configured device, the default device first
 	sessions *sessionMap
 
+	// only set when running with --simulate
+	simulator *simulatedMixer
+
+	// only set when running with --dry-run
+	dryRun *DryRunOptions
+
+	// closed (once) to stop, so that everything waiting on it hears about it
 	stopChannel          chan bool
+	stopOnce             sync.Once
 	version              string
 	verbose              bool
 	masterVolumeStopChan chan bool
@@ -62,28 +71,16 @@ func NewDeej(logger *zap.SugaredLogger, verbose bool) (*Deej, error) {
 		verbose:     verbose,
 	}
 
-	serial, err := NewSerialIO(d, logger)
-	if err != nil {
-		logger.Errorw("Failed to create SerialIO", "error", err)
-		return nil, fmt.Errorf("create new SerialIO: %w", err)
-	}
-
-	d.serial = serial
-
-	sessionFinder, err := newSessionFinder(logger)
-	if err != nil {
-		logger.Errorw("Failed to create SessionFinder", "error", err)
-		return nil, fmt.Errorf("create new SessionFinder: %w", err)
-	}
+	for _, deviceName := range config.DeviceNames() {
+		serial, err := NewSerialIO(d, logger, deviceName)
+		if err != nil {
+			logger.Errorw("Failed to create SerialIO", "device", deviceName, "error", err)
+			return nil, fmt.Errorf("create new SerialIO for device %s: %w", deviceName, err)
+		}
 
-	sessions, err := newSessionMap(d, logger, sessionFinder)
-	if err != nil {
-		logger.Errorw("Failed to create sessionMap", "error", err)
-		return nil, fmt.Errorf("create new sessionMap: %w", err)
+		d.devices = append(d.devices, serial)
 	}
 
-	d.sessions = sessions
-
 	logger.Debug("Created deej instance")
 
 	return d, nil
@@ -93,6 +90,31 @@ func NewDeej(logger *zap.SugaredLogger, verbose bool) (*Deej, error) {
 func (d *Deej) Initialize() error {
 	d.logger.Debug("Initializing")
 
+	// the session map is only created now, so that a dry run never gets to connect to the actual audio server
+	var (
+		sessionFinder SessionFinder
+		err           error
+	)
+
+	if d.dryRun != nil {
+		sessionFinder, err = newMemSessionFinder(d.logger, d.config, *d.dryRun)
+	} else {
+		sessionFinder, err = newSessionFinder(d.logger, d.config)
+	}
+
+	if err != nil {
+		d.logger.Errorw("Failed to create SessionFinder", "error", err)
+		return fmt.Errorf("create new SessionFinder: %w", err)
+	}
+
+	sessions, err := newSessionMap(d, d.logger, sessionFinder)
+	if err != nil {
+		d.logger.Errorw("Failed to create sessionMap", "error", err)
+		return fmt.Errorf("create new sessionMap: %w", err)
+	}
+
+	d.sessions = sessions
+
 	// Config is already loaded in NewDeej, so we don't need to load it again
 	// Just initialize the session map
 	if err := d.sessions.initialize(); err != nil {
@@ -114,80 +136,169 @@ func (d *Deej) Initialize() error {
 	return nil
 }
 
-func (d *Deej) sendSliderNamesToArduino() {
-	if d.config.SliderNames == "" {
-		d.logger.Debug("No slider names configured, skipping send to Arduino")
+func (d *Deej) sendSliderNamesToArduino(serial *SerialIO) {
+	device, ok := d.config.Device(serial.DeviceName())
+	if !ok {
 		return
 	}
 
-	message := fmt.Sprintf("<^%s>", d.config.SliderNames)
-	d.logger.Infow("Sending to serial", "serial", message)
-	d.serial.SendToArduino(message)
+	// routed sliders show where their apps are going next to their name
+	names := d.sessions.sliderNames(device)
+	if names == "" {
+		d.logger.Debugw("No slider names configured, skipping send to Arduino", "device", serial.DeviceName())
+		return
+	}
+
+	message := fmt.Sprintf("<^%s>", names)
+	d.logger.Infow("Sending to serial", "device", serial.DeviceName(), "serial", message)
+	serial.SendToArduino(message)
+}
+
+// resendSliderNames sends a device its slider names again, i.e. after one of its sliders was routed elsewhere
+func (d *Deej) resendSliderNames(deviceName string) {
+	for _, serial := range d.devices {
+		if serial.DeviceName() == deviceName && serial.hasDisplays() {
+			d.sendSliderNamesToArduino(serial)
+		}
+	}
+}
+
+// sendToDisplayDevices sends the given message to every device that might show it
+func (d *Deej) sendToDisplayDevices(message string) {
+	for _, serial := range d.devices {
+		if serial.hasDisplays() {
+			serial.SendToArduino(message)
+		}
+	}
 }
 
+// startMasterVolumeMonitor keeps every display device up to date with the master volume and mute state.
+// session finders that report device changes wake it up when there's something to check. otherwise, it polls:
+// quickly while the volume is moving, and slowly once it settles
 func (d *Deej) startMasterVolumeMonitor() {
 	d.masterVolumeStopChan = make(chan bool)
 
 	go func() {
 		const (
-			lowFreqInterval  = 10 * time.Millisecond
+			lowFreqInterval  = 250 * time.Millisecond
 			highFreqInterval = 10 * time.Millisecond
 			stableThreshold  = 100 // how many stable cycles before returning to low freq
+
+			// changes tend to come in bursts (like an encoder being turned), so wait for one to settle
+			// before checking, rather than checking on every single one of them
+			debounceInterval = 20 * time.Millisecond
 		)
 
 		var (
-			ticker                  = time.NewTicker(lowFreqInterval)
-			currentInterval         = lowFreqInterval
-			lastVolume      float32 = -1
-			lastMute        bool    = false
-			stableCounter   int     = 0
+			lastVolume    float32 = -1
+			lastMute      bool    = false
+			stableCounter int     = 0
+
+			ticker          *time.Ticker
+			tickerChannel   <-chan time.Time
+			currentInterval time.Duration
+
+			deviceChanges = d.sessions.subscribeToDeviceChanges()
+			debounce      = time.NewTimer(0)
+			checkPending  = true // check once right away
 		)
 
-		defer ticker.Stop()
+		startPolling := func(interval time.Duration) {
+			if ticker != nil {
+				ticker.Stop()
+			}
+
+			ticker = time.NewTicker(interval)
+			tickerChannel = ticker.C
+			currentInterval = interval
+		}
+
+		defer func() {
+			debounce.Stop()
+			if ticker != nil {
+				ticker.Stop()
+			}
+		}()
+
+		if deviceChanges == nil {
+			d.logger.Debug("Session finder doesn't report device changes, polling master volume")
+			startPolling(lowFreqInterval)
+		}
+
+		// sendIfChanged sends the master volume and mute state to the display devices, and tells whether they changed
+		sendIfChanged := func() bool {
+			sessions, ok := d.sessions.get(masterSessionName)
+			if !ok || len(sessions) == 0 {
+				return false
+			}
+
+			master := sessions[0]
+			currentVolume := master.GetVolume()
+			currentMute := master.GetMute()
+
+			volumeChanged := lastVolume != currentVolume // && util.SignificantlyDifferent(lastVolume, currentVolume, d.config.NoiseReductionLevel)
+			muteChanged := currentMute != lastMute
+
+			if !volumeChanged && !muteChanged {
+				return false
+			}
+
+			lastVolume = currentVolume
+			lastMute = currentMute
+
+			volumePercent := int(currentVolume * 100)
+			muteState := 0
+			if currentMute {
+				muteState = 1
+			}
+
+			message := fmt.Sprintf("<!%d|%d>", muteState, volumePercent)
+			d.logger.Infow("Sending to serial", "serial", message)
+			d.sendToDisplayDevices(message)
+
+			return true
+		}
 
 		for {
 			select {
-			case <-ticker.C:
-				sessions, ok := d.sessions.get(masterSessionName)
-				if !ok || len(sessions) == 0 {
+			case _, ok := <-deviceChanges:
+				if !ok {
+					d.logger.Warn("Session finder stopped reporting device changes, polling master volume")
+					deviceChanges = nil
+					startPolling(lowFreqInterval)
+
 					continue
 				}
 
-				master := sessions[0]
-				currentVolume := master.GetVolume()
-				currentMute := master.GetMute()
-
-				volumeChanged := lastVolume != currentVolume // && util.SignificantlyDifferent(lastVolume, currentVolume, d.config.NoiseReductionLevel)
-				muteChanged := currentMute != lastMute
+				if !checkPending {
+					checkPending = true
+					debounce.Reset(debounceInterval)
+				}
 
-				if volumeChanged || muteChanged {
-					lastVolume = currentVolume
-					lastMute = currentMute
-					stableCounter = 0
+			// the master session was replaced, i.e. because the default device changed
+			case <-d.sessions.masterReplaced:
+				if !checkPending {
+					checkPending = true
+					debounce.Reset(debounceInterval)
+				}
 
-					volumePercent := int(currentVolume * 100)
-					muteState := 0
-					if currentMute {
-						muteState = 1
-					}
+			case <-debounce.C:
+				checkPending = false
+				sendIfChanged()
 
-					message := fmt.Sprintf("<!%d|%d>", muteState, volumePercent)
-					d.logger.Infow("Sending to serial", "serial", message)
-					d.serial.SendToArduino(message)
+			case <-tickerChannel:
+				if sendIfChanged() {
+					stableCounter = 0
 
 					// Increase polling frequency
 					if currentInterval != highFreqInterval {
-						ticker.Stop()
-						ticker = time.NewTicker(highFreqInterval)
-						currentInterval = highFreqInterval
+						startPolling(highFreqInterval)
 						d.logger.Debug("Switching to high-frequency polling")
 					}
 				} else {
 					stableCounter++
 					if stableCounter >= stableThreshold && currentInterval != lowFreqInterval {
-						ticker.Stop()
-						ticker = time.NewTicker(lowFreqInterval)
-						currentInterval = lowFreqInterval
+						startPolling(lowFreqInterval)
 						d.logger.Debug("Switching to low-frequency polling")
 					}
 				}
@@ -200,7 +311,8 @@ func (d *Deej) startMasterVolumeMonitor() {
 	}()
 }
 
-func (d *Deej) SendInitialMasterVolume() {
+// SendInitialMasterVolume sends the current master volume and mute state to the given device
+func (d *Deej) SendInitialMasterVolume(serial *SerialIO) {
 	sessions, ok := d.sessions.get(masterSessionName)
 	if !ok || len(sessions) == 0 {
 		return
@@ -217,8 +329,8 @@ func (d *Deej) SendInitialMasterVolume() {
 	}
 
 	message := fmt.Sprintf("<!%d|%d>", muteState, volumePercent)
-	d.logger.Infow("Sending initial master volume to serial", "serial", message)
-	d.serial.SendToArduino(message)
+	d.logger.Infow("Sending initial master volume to serial", "device", serial.DeviceName(), "serial", message)
+	serial.SendToArduino(message)
 }
 
 // SetVersion causes deej to add a version string to its tray menu if called before Initialize
@@ -226,6 +338,73 @@ func (d *Deej) SetVersion(version string) {
 	d.version = version
 }
 
+// EnableRecording causes deej to record all traffic with its devices (see recording.go) if called before Initialize
+func (d *Deej) EnableRecording() {
+	for _, serial := range d.devices {
+		serial.recordTraffic = true
+	}
+}
+
+// SetReplay causes deej to play back the given recording instead of connecting to the device it was recorded
+// from, if called before Initialize
+func (d *Deej) SetReplay(options ReplayOptions) error {
+	deviceName, err := checkReplayOptions(options)
+	if err != nil {
+		return fmt.Errorf("check replay options: %w", err)
+	}
+
+	for _, serial := range d.devices {
+		if serial.DeviceName() == deviceName {
+			d.logger.Infow("Replaying recording in place of device", "device", deviceName, "path", options.Path)
+
+			logger := serial.logger.Named("transport")
+			serial.transportOverride = func() Transport {
+				return &replayTransport{logger: logger, options: options}
+			}
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("replay: recording is of device %q, which isn't configured", deviceName)
+}
+
+// EnableSimulation causes deej to connect its default device to a simulated mixer instead of actual hardware,
+// if called before Initialize
+func (d *Deej) EnableSimulation() error {
+	simulator, err := newSimulatedMixer(d.logger)
+	if err != nil {
+		return fmt.Errorf("create simulated mixer: %w", err)
+	}
+
+	d.simulator = simulator
+	serial := d.devices[0]
+
+	logger := serial.logger.Named("transport")
+	serial.transportOverride = func() Transport {
+		return &serialTransport{logger: logger, comPort: simulator.Port(), baudRate: defaultBaudRate}
+	}
+
+	simulator.start()
+
+	return nil
+}
+
+// EnableDryRun causes deej to use in-memory audio sessions instead of actual ones (see session_finder_memory.go),
+// if called before Initialize. volume changes are logged rather than made
+func (d *Deej) EnableDryRun(options DryRunOptions) error {
+	if options.ScriptPath != "" {
+		if _, err := readDryRunScript(options.ScriptPath); err != nil {
+			return fmt.Errorf("check dry run script: %w", err)
+		}
+	}
+
+	d.logger.Infow("Dry run enabled, audio sessions won't be touched", "script", options.ScriptPath)
+	d.dryRun = &options
+
+	return nil
+}
+
 // Verbose returns a boolean indicating whether deej is running in verbose mode
 func (d *Deej) Verbose() bool {
 	return d.verbose
@@ -247,40 +426,14 @@ func (d *Deej) run() {
 	// watch the config file for changes
 	go d.config.WatchConfigFileChanges()
 
-	// connect to the arduino for the first time
-	go func() {
-		if err := d.serial.Start(); err != nil {
-			d.logger.Warnw("Failed to start first-time serial connection", "error", err)
-			// existing error handling...
-		}
-
-		// Add small delay to ensure serial connection is ready
-		time.Sleep(2000 * time.Millisecond)
+	// these send the same feedback to every connected device, so there's only one of each
+	d.startMasterVolumeMonitor()
+	d.startKeepAliveMessageSender()
 
-		// Run initialization
-		d.initializeArduino()
-
-		// Subscribe to reconnection events
-		reconnectChannel := d.serial.SubscribeToReconnectEvents()
-		d.logger.Debug("Subscribed to serial reconnection events")
-
-		// Listen for reconnection events
-		go func() {
-			for {
-				select {
-				case <-reconnectChannel:
-					d.logger.Info("Detected serial reconnection, waiting 3 seconds before re-initializing Arduino")
-					// Add 3-second delay to ensure serial connection is stable
-					time.Sleep(3000 * time.Millisecond)
-					d.logger.Info("Delay complete, now re-initializing Arduino")
-					d.initializeArduino()
-				case <-d.stopChannel:
-					d.logger.Debug("Stopping reconnection listener")
-					return
-				}
-			}
-		}()
-	}()
+	// connect to each arduino for the first time
+	for _, serial := range d.devices {
+		go d.runDevice(serial)
+	}
 
 	// wait until stopped (gracefully)
 	<-d.stopChannel
@@ -296,15 +449,23 @@ func (d *Deej) run() {
 }
 
 func (d *Deej) signalStop() {
-	d.logger.Debug("Signalling stop channel")
-	d.stopChannel <- true
+	d.stopOnce.Do(func() {
+		d.logger.Debug("Signalling stop channel")
+		close(d.stopChannel)
+	})
 }
 
 func (d *Deej) stop() error {
 	d.logger.Info("Stopping")
 
 	d.config.StopWatchingConfigFile()
-	d.serial.Stop()
+	for _, serial := range d.devices {
+		serial.Stop()
+	}
+
+	if d.simulator != nil {
+		d.simulator.stop()
+	}
 
 	// release the session map
 	if err := d.sessions.release(); err != nil {
@@ -326,8 +487,14 @@ func (d *Deej) startKeepAliveMessageSender() {
 
 		sendKeepAlive := func() {
 			d.logger.Debugw("Sending keep-alive message", "message", keepAliveMessage)
-			if err := d.serial.SendToArduino(keepAliveMessage); err != nil {
-				d.logger.Warnw("Failed to send keep-alive message", "error", err)
+			for _, serial := range d.devices {
+				if !serial.hasDisplays() {
+					continue
+				}
+
+				if err := serial.SendToArduino(keepAliveMessage); err != nil {
+					d.logger.Warnw("Failed to send keep-alive message", "device", serial.DeviceName(), "error", err)
+				}
 			}
 		}
 
@@ -349,21 +516,65 @@ func (d *Deej) startKeepAliveMessageSender() {
 	}()
 }
 
-// initializeArduino sends all necessary initialization data to the Arduino
-func (d *Deej) initializeArduino() {
-	d.logger.Info("Initializing Arduino with configuration data")
+// runDevice connects to a single device and initializes it once per connection
+func (d *Deej) runDevice(serial *SerialIO) {
+	logger := d.logger.With("device", serial.DeviceName())
 
-	// Send slider names to Arduino
-	d.sendSliderNamesToArduino()
+	// subscribe before starting, so that we can't miss a reconnection that happens right away
+	reconnectChannel := serial.SubscribeToReconnectEvents()
+	logger.Debug("Subscribed to serial reconnection events")
 
-	// Send initial master volume to Arduino
-	d.SendInitialMasterVolume()
+	if err := serial.Start(); err != nil {
+		logger.Warnw("Failed to start first-time serial connection, will keep trying", "error", err)
+	} else {
 
-	// Start the master volume monitor if it's not already running
-	d.startMasterVolumeMonitor()
+		// Add small delay to ensure serial connection is ready
+		time.Sleep(2000 * time.Millisecond)
 
-	// Start the keep-alive sender if it's not already running
-	d.startKeepAliveMessageSender()
+		// Run initialization
+		d.initializeArduino(serial)
+	}
+
+	// Listen for reconnection events
+	go func() {
+		for {
+			select {
+			case reconnected := <-reconnectChannel:
+				if !reconnected {
+					logger.Debug("Device still unreachable, waiting for it to come back")
+					continue
+				}
+
+				logger.Info("Detected serial reconnection, waiting 3 seconds before re-initializing Arduino")
+				// Add 3-second delay to ensure serial connection is stable
+				time.Sleep(3000 * time.Millisecond)
+				logger.Info("Delay complete, now re-initializing Arduino")
+				d.initializeArduino(serial)
+			case <-d.stopChannel:
+				logger.Debug("Stopping reconnection listener")
+				return
+			}
+		}
+	}()
+}
+
+// initializeArduino sends all necessary initialization data to the given device
+func (d *Deej) initializeArduino(serial *SerialIO) {
+	logger := d.logger.With("device", serial.DeviceName())
+	logger.Info("Initializing Arduino with configuration data")
+
+	// devices that reported their capabilities and have no displays have no use for any of the feedback below.
+	// devices that didn't report anything are assumed to be like the deejx sketch, which has them
+	if !serial.hasDisplays() {
+		logger.Info("Device has no displays, skipping feedback messages")
+		return
+	}
+
+	// Send slider names to Arduino
+	d.sendSliderNamesToArduino(serial)
+
+	// Send initial master volume to Arduino
+	d.SendInitialMasterVolume(serial)
 
-	d.logger.Info("Arduino initialization complete")
+	logger.Info("Arduino initialization complete")
 }
@@ -0,0 +1,76 @@
+package deej
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DeviceEvent is a single diagnostic message a device printed, e.g. "Display 2 initialization failed".
+// devices send these as plain text lines, or as log frames when speaking the framed protocol
+type DeviceEvent struct {
+	Device  string
+	Kind    DeviceEventKind
+	Message string
+
+	// only set for DeviceEventDisplayFailure
+	DisplayID int
+}
+
+// DeviceEventKind classifies a DeviceEvent
+type DeviceEventKind string
+
+// The kinds of diagnostic messages deej recognizes
+const (
+	DeviceEventError          DeviceEventKind = "error"           // "Error: <reason>"
+	DeviceEventDisplayFailure DeviceEventKind = "display-failure" // "Display <N> initialization failed"
+	DeviceEventUnknownCommand DeviceEventKind = "unknown-command" // "Unknown command"
+	DeviceEventKeepAlive      DeviceEventKind = "keep-alive"      // "Keep-alive signal received"
+	DeviceEventNamesParsed    DeviceEventKind = "names-parsed"    // "Parsed name list"
+	DeviceEventOther          DeviceEventKind = "other"           // anything else
+)
+
+const deviceErrorPrefix = "Error:"
+
+var displayFailurePattern = regexp.MustCompile(`^Display (\d+) initialization failed$`)
+
+// parseDeviceEvent classifies a diagnostic line. it never fails, since any line is at least DeviceEventOther
+func parseDeviceEvent(device string, line string) DeviceEvent {
+	line = strings.TrimSpace(line)
+	event := DeviceEvent{Device: device, Kind: DeviceEventOther, Message: line}
+
+	if strings.HasPrefix(line, deviceErrorPrefix) {
+		event.Kind = DeviceEventError
+		event.Message = strings.TrimSpace(strings.TrimPrefix(line, deviceErrorPrefix))
+
+		return event
+	}
+
+	if match := displayFailurePattern.FindStringSubmatch(line); match != nil {
+		event.Kind = DeviceEventDisplayFailure
+		event.DisplayID, _ = strconv.Atoi(match[1])
+
+		return event
+	}
+
+	switch line {
+	case "Unknown command":
+		event.Kind = DeviceEventUnknownCommand
+	case "Keep-alive signal received":
+		event.Kind = DeviceEventKeepAlive
+	case "Parsed name list":
+		event.Kind = DeviceEventNamesParsed
+	}
+
+	return event
+}
+
+// IsProblem reports whether the event indicates something went wrong on the device
+func (de DeviceEvent) IsProblem() bool {
+	switch de.Kind {
+	case DeviceEventError, DeviceEventDisplayFailure, DeviceEventUnknownCommand:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,60 @@
+package deej
+
+import "testing"
+
+func TestParseDeviceEvent(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		want        DeviceEvent
+		wantProblem bool
+	}{
+		{
+			name:        "error",
+			line:        "Error: display bus busy\r\n",
+			want:        DeviceEvent{Device: "desk", Kind: DeviceEventError, Message: "display bus busy"},
+			wantProblem: true,
+		},
+		{
+			name:        "display failure",
+			line:        "Display 2 initialization failed",
+			want:        DeviceEvent{Device: "desk", Kind: DeviceEventDisplayFailure, Message: "Display 2 initialization failed", DisplayID: 2},
+			wantProblem: true,
+		},
+		{
+			name:        "unknown command",
+			line:        "Unknown command\r\n",
+			want:        DeviceEvent{Device: "desk", Kind: DeviceEventUnknownCommand, Message: "Unknown command"},
+			wantProblem: true,
+		},
+		{
+			name: "keep-alive",
+			line: "Keep-alive signal received",
+			want: DeviceEvent{Device: "desk", Kind: DeviceEventKeepAlive, Message: "Keep-alive signal received"},
+		},
+		{
+			name: "names parsed",
+			line: "Parsed name list",
+			want: DeviceEvent{Device: "desk", Kind: DeviceEventNamesParsed, Message: "Parsed name list"},
+		},
+		{
+			name: "anything else",
+			line: "Display 2 initialized",
+			want: DeviceEvent{Device: "desk", Kind: DeviceEventOther, Message: "Display 2 initialized"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseDeviceEvent("desk", tt.line)
+
+			if got != tt.want {
+				t.Errorf("parseDeviceEvent(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+
+			if got.IsProblem() != tt.wantProblem {
+				t.Errorf("IsProblem() = %v, want %v", got.IsProblem(), tt.wantProblem)
+			}
+		})
+	}
+}
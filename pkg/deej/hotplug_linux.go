@@ -0,0 +1,96 @@
+package deej
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	deviceNodeDir = "/dev"
+
+	// how long a single wait for inotify events may block before checking whether we should stop
+	hotplugPollTimeoutMillis = 1000
+)
+
+// watchDeviceNodes reports the path of every serial device node that appears (or has its permissions changed
+// by udev, which is usually when it becomes usable) under /dev, until stop is closed
+func watchDeviceNodes(logger *zap.SugaredLogger, stop chan struct{}) (chan string, error) {
+	logger = logger.Named("hotplug")
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("init inotify: %w", err)
+	}
+
+	if _, err := unix.InotifyAddWatch(fd, deviceNodeDir, unix.IN_CREATE|unix.IN_ATTRIB); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("watch %s: %w", deviceNodeDir, err)
+	}
+
+	nodes := make(chan string, 1)
+
+	go func() {
+		defer unix.Close(fd)
+
+		buf := make([]byte, 4096)
+		pollFds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			if n, err := unix.Poll(pollFds, hotplugPollTimeoutMillis); err != nil || n == 0 {
+				if err != nil && err != unix.EINTR {
+					logger.Warnw("Failed to wait for device node events, stopping", "error", err)
+					return
+				}
+
+				continue
+			}
+
+			n, err := unix.Read(fd, buf)
+			if err != nil {
+				if err == unix.EAGAIN || err == unix.EINTR {
+					continue
+				}
+
+				logger.Warnw("Failed to read device node events, stopping", "error", err)
+				return
+			}
+
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameStart := offset + unix.SizeofInotifyEvent
+				name := string(bytes.TrimRight(buf[nameStart:nameStart+int(event.Len)], "\x00"))
+				offset = nameStart + int(event.Len)
+
+				if !isSerialDeviceNode(name) {
+					continue
+				}
+
+				path := filepath.Join(deviceNodeDir, name)
+				logger.Debugw("Serial device node appeared", "path", path)
+
+				select {
+				case nodes <- path:
+				default:
+				}
+			}
+		}
+	}()
+
+	return nodes, nil
+}
+
+func isSerialDeviceNode(name string) bool {
+	return strings.HasPrefix(name, "ttyUSB") || strings.HasPrefix(name, "ttyACM")
+}
@@ -0,0 +1,12 @@
+package deej
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// watchDeviceNodes isn't implemented on Windows, where reconnecting relies on backoff alone
+func watchDeviceNodes(logger *zap.SugaredLogger, stop chan struct{}) (chan string, error) {
+	return nil, errors.New("hotplug: not supported on windows")
+}
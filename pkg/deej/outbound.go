@@ -0,0 +1,268 @@
+package deej
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// every host message is written by a single writer goroutine per connection, out of a queue that holds at most one
+// message of each kind (the command character, e.g. '!' for master volume feedback). queueing a message supersedes
+// any older message of the same kind that hasn't been written yet, since only the latest one matters.
+//
+// devices that acknowledge messages get every unacknowledged message re-sent until it's either acknowledged,
+// superseded or out of attempts. acks carry the checksum of the message they acknowledge (see messageChecksum),
+// so that a late ack for an older message doesn't count for a newer one of the same kind. in text they look like
+// "&X" followed by the checksum in 4 hex digits (e.g. "&!3FA2"), and ack frames carry the acknowledged frame type
+// followed by the checksum. until a device acknowledges something, it's assumed not to support acknowledgements at all
+const (
+	ackLinePrefix   = "&"
+	ackChecksumLen  = 4 // hex digits
+	ackFramePayload = 3 // frame type, checksum high, checksum low
+
+	ackTimeout       = 300 * time.Millisecond
+	maxSendAttempts  = 3
+	ackCheckInterval = 50 * time.Millisecond
+)
+
+// lower values are written first
+var hostMessagePriorities = map[byte]int{
+	'~': 0, // protocol negotiation
+	'?': 1, // capabilities request
+	'!': 2, // master volume feedback
+	'^': 3, // slider names
+	'#': 4, // keep-alive
+}
+
+const defaultHostMessagePriority = 3
+
+// maps acknowledged frame types back to the kind of message they acknowledge
+var frameTypeMessageKinds = map[byte]byte{
+	frameTypeMaster:    '!',
+	frameTypeNames:     '^',
+	frameTypeKeepAlive: '#',
+	frameTypeCaps:      '?',
+}
+
+type outboundMessage struct {
+	kind     byte
+	message  string
+	attempts int
+	sentAt   time.Time
+
+	// of the last attempt, as written
+	checksum uint16
+}
+
+type commandQueue struct {
+	logger *zap.SugaredLogger
+	lock   sync.Mutex
+
+	pending  map[byte]*outboundMessage // waiting to be written
+	inFlight map[byte]*outboundMessage // written, waiting for an acknowledgement
+
+	acksSupported bool
+
+	wake chan struct{}
+	done chan struct{}
+
+	// closed once run returns
+	stopped chan struct{}
+}
+
+func newCommandQueue(logger *zap.SugaredLogger) *commandQueue {
+	return &commandQueue{
+		logger:   logger.Named("queue"),
+		pending:  make(map[byte]*outboundMessage),
+		inFlight: make(map[byte]*outboundMessage),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// enqueue adds a message to the queue, replacing any unwritten message of the same kind
+func (q *commandQueue) enqueue(message string) {
+	kind := messageKind(message)
+
+	q.lock.Lock()
+	if superseded, ok := q.pending[kind]; ok {
+		q.logger.Debugw("Superseding queued message", "old", superseded.message, "new", message)
+	}
+
+	q.pending[kind] = &outboundMessage{kind: kind, message: message}
+	q.lock.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// acknowledge marks the in-flight message of the given kind as delivered if it's the one with the given checksum,
+// and enables retries from now on
+func (q *commandQueue) acknowledge(kind byte, checksum uint16) {
+	q.lock.Lock()
+	if !q.acksSupported {
+		q.logger.Debug("Device acknowledges messages, enabling retries")
+		q.acksSupported = true
+	}
+
+	inFlight, ok := q.inFlight[kind]
+	stale := ok && inFlight.checksum != checksum
+	q.lock.Unlock()
+
+	if stale {
+		q.logger.Debugw("Ignoring acknowledgement of an older message", "kind", string(kind), "checksum", checksum)
+		return
+	}
+
+	q.settle(kind)
+}
+
+// settle marks the in-flight message of the given kind as delivered. unlike acknowledge, it's meant for replies
+// that even devices without acknowledgements send (e.g. a capabilities report)
+func (q *commandQueue) settle(kind byte) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if acked, ok := q.inFlight[kind]; ok {
+		q.logger.Debugw("Message acknowledged", "message", acked.message, "attempts", acked.attempts)
+		delete(q.inFlight, kind)
+	}
+
+	// an acknowledgement might've freed up a kind that has a newer message waiting behind it
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next picks the next message to write: the highest priority pending message whose kind isn't still waiting
+// for an acknowledgement, or failing that, an in-flight message that's due for another attempt
+func (q *commandQueue) next(now time.Time) *outboundMessage {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var chosen *outboundMessage
+
+	for kind, msg := range q.pending {
+		if inFlight, ok := q.inFlight[kind]; ok && now.Sub(inFlight.sentAt) < ackTimeout {
+			continue
+		}
+
+		if chosen == nil || messagePriority(msg.kind) < messagePriority(chosen.kind) {
+			chosen = msg
+		}
+	}
+
+	if chosen != nil {
+		delete(q.pending, chosen.kind)
+		return q.markSent(chosen, now)
+	}
+
+	for kind, msg := range q.inFlight {
+		if now.Sub(msg.sentAt) < ackTimeout {
+			continue
+		}
+
+		if msg.attempts >= maxSendAttempts {
+			q.logger.Warnw("Message wasn't acknowledged, giving up", "message", msg.message, "attempts", msg.attempts)
+			delete(q.inFlight, kind)
+			continue
+		}
+
+		q.logger.Debugw("Message wasn't acknowledged in time, retrying", "message", msg.message, "attempts", msg.attempts)
+		return q.markSent(msg, now)
+	}
+
+	return nil
+}
+
+// assumes the lock is held
+func (q *commandQueue) markSent(msg *outboundMessage, now time.Time) *outboundMessage {
+	msg.attempts++
+	msg.sentAt = now
+
+	if q.acksSupported {
+		q.inFlight[msg.kind] = msg
+	}
+
+	return msg
+}
+
+// run writes queued messages until stopped. encode turns each message into what's written, and write writes it
+func (q *commandQueue) run(encode func(message string) ([]byte, error), write func(data []byte) error) {
+	defer close(q.stopped)
+
+	ticker := time.NewTicker(ackCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+
+		for msg := q.next(time.Now()); msg != nil; msg = q.next(time.Now()) {
+
+			// don't start another write once we've been told to stop
+			select {
+			case <-q.done:
+				return
+			default:
+			}
+
+			data, err := encode(msg.message)
+			if err != nil {
+				q.logger.Warnw("Failed to encode queued message", "message", msg.message, "error", err)
+				continue
+			}
+
+			// the ack can only come in after the write, so there's no racing it
+			q.lock.Lock()
+			msg.checksum = messageChecksum(data)
+			q.lock.Unlock()
+
+			if err := write(data); err != nil {
+				q.logger.Warnw("Failed to write queued message", "message", msg.message, "error", err)
+			}
+		}
+	}
+}
+
+// stop stops run and waits for it to return, so that nothing is written anymore once it does.
+// it must only be called once, and only after run was started
+func (q *commandQueue) stop() {
+	close(q.done)
+	<-q.stopped
+}
+
+func messageKind(message string) byte {
+	if len(message) < 2 {
+		return 0
+	}
+
+	return message[1]
+}
+
+// messageChecksum identifies a message as written: a text message by the CRC-16 of all of its bytes,
+// and a frame by its own CRC
+func messageChecksum(data []byte) uint16 {
+	if len(data) >= frameHeaderLen+frameCRCLen && data[0] == frameStart {
+		return uint16(data[len(data)-2])<<8 | uint16(data[len(data)-1])
+	}
+
+	return crc16(data)
+}
+
+func messagePriority(kind byte) int {
+	if priority, ok := hostMessagePriorities[kind]; ok {
+		return priority
+	}
+
+	return defaultHostMessagePriority
+}
@@ -0,0 +1,191 @@
+package deej
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestCommandQueue(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name string
+
+		// run drives the queue, returning every message it picked to write, in order
+		run  func(q *commandQueue) []string
+		want []string
+	}{
+		{
+			name: "priority order",
+			run: func(q *commandQueue) []string {
+				for _, message := range []string{"<#>", "<^a|b>", "<!0|40>", "<?>", "<~1>"} {
+					q.enqueue(message)
+				}
+
+				return drainCommandQueue(q, start)
+			},
+			want: []string{"<~1>", "<?>", "<!0|40>", "<^a|b>", "<#>"},
+		},
+		{
+			name: "newer messages supersede unwritten ones",
+			run: func(q *commandQueue) []string {
+				q.enqueue("<!0|40>")
+				q.enqueue("<!0|50>")
+
+				return drainCommandQueue(q, start)
+			},
+			want: []string{"<!0|50>"},
+		},
+		{
+			name: "nothing is retried without acknowledgements",
+			run: func(q *commandQueue) []string {
+				q.enqueue("<!0|40>")
+				written := drainCommandQueue(q, start)
+
+				return append(written, drainCommandQueue(q, start.Add(ackTimeout))...)
+			},
+			want: []string{"<!0|40>"},
+		},
+		{
+			name: "retried until out of attempts",
+			run: func(q *commandQueue) []string {
+				q.acknowledge('#', 0)
+				q.enqueue("<!0|40>")
+
+				written := []string{}
+				for attempt := 0; attempt <= maxSendAttempts; attempt++ {
+					written = append(written, drainCommandQueue(q, start.Add(time.Duration(attempt)*ackTimeout))...)
+				}
+
+				return written
+			},
+			want: []string{"<!0|40>", "<!0|40>", "<!0|40>"},
+		},
+		{
+			name: "a newer message waits for the one in flight",
+			run: func(q *commandQueue) []string {
+				q.acknowledge('#', 0)
+				q.enqueue("<!0|40>")
+				written := drainCommandQueue(q, start)
+
+				q.enqueue("<!0|50>")
+				written = append(written, drainCommandQueue(q, start)...)
+
+				q.acknowledge('!', messageChecksum([]byte("<!0|40>")))
+
+				return append(written, drainCommandQueue(q, start)...)
+			},
+			want: []string{"<!0|40>", "<!0|50>"},
+		},
+		{
+			name: "stale acknowledgements are ignored",
+			run: func(q *commandQueue) []string {
+				q.acknowledge('#', 0)
+				q.enqueue("<!0|40>")
+				written := drainCommandQueue(q, start)
+
+				q.enqueue("<!0|50>")
+				q.acknowledge('!', messageChecksum([]byte("<!0|30>")))
+
+				return append(written, drainCommandQueue(q, start)...)
+			},
+			want: []string{"<!0|40>"},
+		},
+		{
+			name: "settled without an acknowledgement",
+			run: func(q *commandQueue) []string {
+				q.acknowledge('#', 0)
+				q.enqueue("<?>")
+				written := drainCommandQueue(q, start)
+
+				q.settle('?')
+
+				return append(written, drainCommandQueue(q, start.Add(ackTimeout))...)
+			},
+			want: []string{"<?>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newCommandQueue(zap.NewNop().Sugar())
+
+			if got := tt.run(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// drainCommandQueue picks every message that's due at the given time, checksumming each one as run would
+func drainCommandQueue(q *commandQueue, now time.Time) []string {
+	written := []string{}
+
+	for msg := q.next(now); msg != nil; msg = q.next(now) {
+		msg.checksum = messageChecksum([]byte(msg.message))
+		written = append(written, msg.message)
+	}
+
+	return written
+}
+
+func TestMessageChecksum(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want uint16
+	}{
+		{"text message", []byte("<!0|40>"), 0x4044},
+		{"frame", []byte{0x02, 0x01, 0x03, 0x02, 0x01, 0x28, 0xD8, 0xBA}, 0xD8BA},
+		{"text that's too short to be a frame", []byte{0x02, 0x01}, crc16([]byte{0x02, 0x01})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageChecksum(tt.data); got != tt.want {
+				t.Errorf("messageChecksum(% x) = %#04x, want %#04x", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandQueueStopWaitsForWriter(t *testing.T) {
+	q := newCommandQueue(zap.NewNop().Sugar())
+
+	writing := make(chan struct{})
+	release := make(chan struct{})
+
+	go q.run(func(message string) ([]byte, error) {
+		return []byte(message), nil
+	}, func(data []byte) error {
+		close(writing)
+		<-release
+		return nil
+	})
+
+	q.enqueue("<!0|40>")
+	<-writing
+
+	stopped := make(chan struct{})
+	go func() {
+		q.stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("stop() returned while a write was still in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop() didn't return once the write finished")
+	}
+}
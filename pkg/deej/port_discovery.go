@@ -0,0 +1,160 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+	"go.uber.org/zap"
+)
+
+const (
+
+	// when com_port is set to this, deej looks for the device on its own
+	comPortAuto = "auto"
+
+	// opening a port resets most arduinos, which then take a bit over a second to boot and start talking.
+	// a device that hasn't sent anything we recognize by the time this passes is probably not a deej
+	portProbeTimeout      = 3 * time.Second
+	portProbeReadTimeout  = 100 * time.Millisecond
+	portProbeRequestDelay = 500 * time.Millisecond
+
+	// a slider line with fewer fields than this could just as well be some other device printing numbers
+	portProbeMinFields = 2
+)
+
+var errNoDevicePortFound = errors.New("discovery: no serial port with a deej device found")
+
+// discoverSerialPort enumerates the system's serial ports and returns the first one with a device that
+// speaks the deej protocol. if usbIDs (in "VID:PID" form) are given, only USB ports matching one of them
+// are considered. otherwise, all USB serial ports are, but since we don't know what's on the other side
+// we only listen to them. expectedControls is how many fields the device's slider lines should have at least
+func discoverSerialPort(logger *zap.SugaredLogger, baudRate int, usbIDs []string, expectedControls int) (string, error) {
+	logger = logger.Named("discovery")
+
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		logger.Warnw("Failed to enumerate serial ports", "error", err)
+		return "", fmt.Errorf("enumerate serial ports: %w", err)
+	}
+
+	candidates := []string{}
+
+	for _, port := range ports {
+		if !port.IsUSB {
+			continue
+		}
+
+		usbID := strings.ToLower(fmt.Sprintf("%s:%s", port.VID, port.PID))
+
+		if len(usbIDs) > 0 && !containsUSBID(usbIDs, usbID) {
+			logger.Debugw("Skipping port with non-matching USB ID", "port", port.Name, "usbID", usbID)
+			continue
+		}
+
+		candidates = append(candidates, port.Name)
+	}
+
+	logger.Debugw("Probing candidate serial ports", "candidates", candidates)
+
+	for _, candidate := range candidates {
+		if probeSerialPort(logger, candidate, baudRate, expectedControls, len(usbIDs) > 0) {
+			logger.Infow("Found deej device", "port", candidate)
+			return candidate, nil
+		}
+	}
+
+	return "", errNoDevicePortFound
+}
+
+func containsUSBID(usbIDs []string, usbID string) bool {
+	for _, candidate := range usbIDs {
+		if strings.ToLower(candidate) == usbID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// probeSerialPort briefly opens the given port and reports whether whatever's on the other side sends either a
+// capabilities report or slider lines with the expected number of fields. unless allowed to write to the port,
+// it won't ask for a capabilities report, since that might mean something else to whatever's there
+func probeSerialPort(logger *zap.SugaredLogger, portName string, baudRate int, expectedControls int, write bool) bool {
+	port, err := serial.Open(portName, &serial.Mode{
+		BaudRate: baudRate,
+		DataBits: 8,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	})
+
+	if err != nil {
+		logger.Debugw("Failed to open candidate port", "port", portName, "error", err)
+		return false
+	}
+
+	defer port.Close()
+
+	if err := port.SetReadTimeout(portProbeReadTimeout); err != nil {
+		logger.Debugw("Failed to set read timeout on candidate port", "port", portName, "error", err)
+		return false
+	}
+
+	var (
+		deadline    = time.Now().Add(portProbeTimeout)
+		lastRequest time.Time
+		pending     string
+		buf         = make([]byte, 128)
+		minFields   = expectedControls
+	)
+
+	if minFields < portProbeMinFields {
+		minFields = portProbeMinFields
+	}
+
+	for time.Now().Before(deadline) {
+
+		// devices only send slider lines when something changes, so keep asking them to describe themselves
+		if write && time.Since(lastRequest) >= portProbeRequestDelay {
+			port.Write([]byte(capabilitiesRequest))
+			lastRequest = time.Now()
+		}
+
+		n, err := port.Read(buf)
+		if err != nil {
+			logger.Debugw("Failed to read from candidate port", "port", portName, "error", err)
+			return false
+		}
+
+		pending += string(buf[:n])
+
+		for {
+			lineEnd := strings.IndexByte(pending, '\n')
+			if lineEnd < 0 {
+				break
+			}
+
+			line := strings.TrimRight(pending[:lineEnd], "\r") + "\r\n"
+			pending = pending[lineEnd+1:]
+
+			if strings.HasPrefix(line, capabilitiesLinePrefix) {
+				if _, err := parseCapabilities(line); err == nil {
+					return true
+				}
+
+				continue
+			}
+
+			if expectedLinePattern.MatchString(line) && strings.Count(line, "|")+1 >= minFields {
+				return true
+			}
+		}
+	}
+
+	logger.Debugw("Candidate port didn't speak deej in time", "port", portName)
+
+	return false
+}
@@ -0,0 +1,260 @@
+package deej
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// deej devices speak one of two wire formats:
+//
+// the text format, which is what every sketch speaks out of the box. the device sends lines such as
+// "=|50|20|100\r\n" and the host sends messages such as "<!1|40>", "<^names>" and "<#>"
+//
+// the framed format, which adds a version, a type, a length and a checksum to every message:
+//
+//	[frameStart] [version] [type] [length] [payload: length bytes] [crc16 high] [crc16 low]
+//
+// the CRC is CRC-16/CCITT-FALSE over everything between frameStart and the CRC itself.
+// the host always starts out speaking text, and asks for the framed format right after connecting by sending
+// "<~V>" (V being protocolVersion). devices that support it reply with a hello frame and speak framed from then on.
+// devices that don't are left alone, so the text format remains the fallback. inbound framed and text messages
+// can be told apart by their first byte, which means we can always read both
+const (
+	protocolVersion = 1
+
+	frameStart     = 0x02 // STX, which can never start a text line
+	frameHeaderLen = 4    // start, version, type, length
+	frameCRCLen    = 2
+
+	frameTypeHello     = 0x01 // both directions, payload: the sender's protocol version
+	frameTypeSliders   = 0x02 // device to host, payload: one byte per control (see sliderValue* below)
+	frameTypeMaster    = 0x03 // host to device, payload: mute (0/1), volume (0-100)
+	frameTypeNames     = 0x04 // host to device, payload: slider names separated by '|'
+	frameTypeKeepAlive = 0x05 // host to device, no payload
+	frameTypeLog       = 0x06 // device to host, payload: a free-form text line
+	frameTypeCaps      = 0x07 // host to device: no payload (a request), device to host: a capabilities report
+	frameTypeAck       = 0x08 // device to host, payload: the type and CRC of the frame being acknowledged
+
+	// slider payload bytes 0-100 are percent values, these stand for the text format's special characters
+	sliderValueEqual = 0xF0
+	sliderValuePlus  = 0xF1
+	sliderValueMinus = 0xF2
+	sliderValueCaret = 0xF3
+
+	// text-format request the host sends to ask for the framed format
+	protocolRequestFormat = "<~%d>"
+
+	protocolAuto = "auto" // negotiate the framed format, falling back to text
+	protocolText = "text" // never ask for the framed format
+)
+
+var (
+	errFrameChecksum = errors.New("protocol: frame checksum mismatch")
+	errFrameVersion  = errors.New("protocol: unsupported frame version")
+	errFrameLength   = errors.New("protocol: invalid frame length")
+)
+
+// payload lengths of the frame types that always carry the same amount of data
+var frameTypePayloadLengths = map[byte]int{
+	frameTypeHello:     1,
+	frameTypeMaster:    2,
+	frameTypeKeepAlive: 0,
+	frameTypeAck:       ackFramePayload,
+}
+
+var sliderValueCharacters = map[byte]string{
+	sliderValueEqual: "=",
+	sliderValuePlus:  "+",
+	sliderValueMinus: "-",
+	sliderValueCaret: "^",
+}
+
+type frame struct {
+	frameType byte
+	payload   []byte
+}
+
+// peekFrameStart reports whether the next message waiting in the reader is a frame
+func peekFrameStart(reader *bufio.Reader) (bool, error) {
+	next, err := reader.Peek(1)
+	if err != nil {
+		return false, err
+	}
+
+	return next[0] == frameStart, nil
+}
+
+// readTextLine reads a single text-format line, always returning it with a \r\n terminator
+func readTextLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return line, err
+	}
+
+	// the arduino terminates its lines with \r\n, but people typing into a pty or netcat usually won't
+	if !strings.HasSuffix(line, "\r\n") {
+		line = strings.TrimSuffix(line, "\n") + "\r\n"
+	}
+
+	return line, nil
+}
+
+// readFrame reads a single frame. a frame that fails validation is reported with errFrameChecksum, errFrameLength
+// or errFrameVersion. in that case only its start byte has been consumed (unless it was a valid frame of another
+// version, which is skipped entirely), since its length might've been what got corrupted. callers should
+// resynchronize with skipToFrameStart before reading on
+func readFrame(reader *bufio.Reader) (frame, error) {
+	header, err := reader.Peek(frameHeaderLen)
+	if err != nil {
+		return frame{}, err
+	}
+
+	version, frameType, length := header[1], header[2], int(header[3])
+
+	if expected, ok := frameTypePayloadLengths[frameType]; ok && version == protocolVersion && length != expected {
+		reader.Discard(1)
+		return frame{}, errFrameLength
+	}
+
+	// the whole frame always fits in the reader's buffer, so we can check it before consuming any of it.
+	// if the stream ends first, its length is likely what's wrong, and whatever's left might still be usable
+	raw, err := reader.Peek(frameHeaderLen + length + frameCRCLen)
+	if errors.Is(err, io.EOF) && len(raw) > frameHeaderLen {
+		reader.Discard(1)
+		return frame{}, errFrameLength
+	}
+
+	if err != nil {
+		return frame{}, err
+	}
+
+	// everything after the start byte and before the CRC
+	body := raw[1 : len(raw)-frameCRCLen]
+	expected := uint16(raw[len(raw)-2])<<8 | uint16(raw[len(raw)-1])
+
+	if crc16(body) != expected {
+		reader.Discard(1)
+		return frame{}, errFrameChecksum
+	}
+
+	payload := append([]byte{}, body[frameHeaderLen-1:]...)
+	reader.Discard(len(raw))
+
+	if version != protocolVersion {
+		return frame{}, errFrameVersion
+	}
+
+	return frame{frameType: frameType, payload: payload}, nil
+}
+
+// skipToFrameStart drops whatever's left of an invalid frame, up to the next frame's start byte. text can follow
+// a frame when the device hasn't switched to the framed protocol yet, so unless acrossLines is set this also
+// stops right after the end of the current line
+func skipToFrameStart(reader *bufio.Reader, acrossLines bool) (int, error) {
+	skipped := 0
+
+	for {
+		next, err := reader.Peek(1)
+		if err != nil {
+			return skipped, err
+		}
+
+		b := next[0]
+		if b == frameStart {
+			return skipped, nil
+		}
+
+		reader.Discard(1)
+		skipped++
+
+		if b == '\n' && !acrossLines {
+			return skipped, nil
+		}
+	}
+}
+
+func encodeFrame(frameType byte, payload []byte) []byte {
+	if len(payload) > 0xFF {
+		payload = payload[:0xFF]
+	}
+
+	encoded := []byte{frameStart, protocolVersion, frameType, byte(len(payload))}
+	encoded = append(encoded, payload...)
+
+	crc := crc16(encoded[1:])
+
+	return append(encoded, byte(crc>>8), byte(crc))
+}
+
+// encodeHostMessage translates a text-format host message (e.g. "<!1|40>") into its framed equivalent
+func encodeHostMessage(message string) ([]byte, error) {
+	if len(message) < 3 || message[0] != '<' || message[len(message)-1] != '>' {
+		return nil, fmt.Errorf("protocol: malformed host message %q", message)
+	}
+
+	body := message[2 : len(message)-1]
+
+	switch message[1] {
+	case '!':
+		parts := strings.Split(body, "|")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("protocol: malformed master message %q", message)
+		}
+
+		mute, muteErr := strconv.Atoi(parts[0])
+		volume, volumeErr := strconv.Atoi(parts[1])
+		if muteErr != nil || volumeErr != nil {
+			return nil, fmt.Errorf("protocol: malformed master message %q", message)
+		}
+
+		return encodeFrame(frameTypeMaster, []byte{byte(mute), byte(volume)}), nil
+	case '^':
+		return encodeFrame(frameTypeNames, []byte(body)), nil
+	case '#':
+		return encodeFrame(frameTypeKeepAlive, nil), nil
+	case '?':
+		return encodeFrame(frameTypeCaps, nil), nil
+	}
+
+	return nil, fmt.Errorf("protocol: unknown host message %q", message)
+}
+
+// decodeSliderPayload turns a sliders frame payload into the same fields a text line would've been split into
+func decodeSliderPayload(payload []byte) ([]string, error) {
+	fields := make([]string, len(payload))
+
+	for idx, value := range payload {
+		if character, ok := sliderValueCharacters[value]; ok {
+			fields[idx] = character
+		} else if value <= 100 {
+			fields[idx] = strconv.Itoa(int(value))
+		} else {
+			return nil, fmt.Errorf("protocol: invalid slider value 0x%02x at index %d", value, idx)
+		}
+	}
+
+	return fields, nil
+}
+
+// crc16 implements CRC-16/CCITT-FALSE (polynomial 0x1021, initial value 0xFFFF)
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
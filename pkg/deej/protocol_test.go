@@ -0,0 +1,184 @@
+package deej
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want uint16
+	}{
+		{"check value", "123456789", 0x29B1},
+		{"empty", "", 0xFFFF},
+		{"single byte", "A", 0xB915},
+		{"text message", "<!0|40>", 0x4044},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crc16([]byte(tt.data)); got != tt.want {
+				t.Errorf("crc16(%q) = %#04x, want %#04x", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeHostMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []byte
+		wantErr bool
+	}{
+		{"master", "<!1|40>", []byte{0x02, 0x01, 0x03, 0x02, 0x01, 0x28, 0xD8, 0xBA}, false},
+		{"names", "<^a|b>", []byte{0x02, 0x01, 0x04, 0x03, 'a', '|', 'b', 0xF4, 0xE1}, false},
+		{"keep-alive", "<#>", []byte{0x02, 0x01, 0x05, 0x00, 0x04, 0x59}, false},
+		{"capabilities request", "<?>", []byte{0x02, 0x01, 0x07, 0x00, 0x62, 0x3B}, false},
+		{"master with too few fields", "<!1>", nil, true},
+		{"master with a non-numeric volume", "<!1|loud>", nil, true},
+		{"unknown kind", "<*>", nil, true},
+		{"unterminated", "<!1|40", nil, true},
+		{"too short", "<>", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeHostMessage(tt.message)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encodeHostMessage(%q) error = %v, wantErr %v", tt.message, err, tt.wantErr)
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("encodeHostMessage(%q) = % x, want % x", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+// testFrame builds a frame of any version, with a valid CRC
+func testFrame(version byte, frameType byte, payload ...byte) []byte {
+	encoded := append([]byte{frameStart, version, frameType, byte(len(payload))}, payload...)
+	crc := crc16(encoded[1:])
+
+	return append(encoded, byte(crc>>8), byte(crc))
+}
+
+func TestReadFrame(t *testing.T) {
+	sliders := testFrame(protocolVersion, frameTypeSliders, 50, sliderValuePlus, 100)
+
+	corrupted := append([]byte{}, sliders...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+
+	tests := []struct {
+		name string
+		data []byte
+
+		want    frame
+		wantErr error
+
+		// what's left in the reader afterwards
+		wantRemaining []byte
+	}{
+		{
+			name:          "sliders",
+			data:          append(append([]byte{}, sliders...), "=|1\r\n"...),
+			want:          frame{frameType: frameTypeSliders, payload: []byte{50, sliderValuePlus, 100}},
+			wantRemaining: []byte("=|1\r\n"),
+		},
+		{
+			name:          "empty payload",
+			data:          testFrame(protocolVersion, frameTypeKeepAlive),
+			want:          frame{frameType: frameTypeKeepAlive, payload: []byte{}},
+			wantRemaining: []byte{},
+		},
+		{
+			name:          "checksum mismatch only consumes the start byte",
+			data:          corrupted,
+			wantErr:       errFrameChecksum,
+			wantRemaining: corrupted[1:],
+		},
+		{
+			name:          "wrong length for a fixed length type",
+			data:          testFrame(protocolVersion, frameTypeHello, 1, 2),
+			wantErr:       errFrameLength,
+			wantRemaining: testFrame(protocolVersion, frameTypeHello, 1, 2)[1:],
+		},
+		{
+			name:          "stream ends mid-frame",
+			data:          sliders[:len(sliders)-1],
+			wantErr:       errFrameLength,
+			wantRemaining: sliders[1 : len(sliders)-1],
+		},
+		{
+			name:          "stream ends mid-header",
+			data:          sliders[:2],
+			wantErr:       io.EOF,
+			wantRemaining: sliders[:2],
+		},
+		{
+			name:          "another version is skipped entirely",
+			data:          append(testFrame(protocolVersion+1, frameTypeKeepAlive), 'x'),
+			wantErr:       errFrameVersion,
+			wantRemaining: []byte{'x'},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(bytes.NewReader(tt.data))
+			got, err := readFrame(reader)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("readFrame() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got.frameType != tt.want.frameType || !bytes.Equal(got.payload, tt.want.payload) {
+				t.Errorf("readFrame() = %+v, want %+v", got, tt.want)
+			}
+
+			remaining, _ := io.ReadAll(reader)
+			if !bytes.Equal(remaining, tt.wantRemaining) {
+				t.Errorf("readFrame() left % x, want % x", remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestSkipToFrameStart(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		acrossLines bool
+
+		wantSkipped   int
+		wantRemaining string
+	}{
+		{"stops at the next frame", "abc\x02rest", false, 3, "\x02rest"},
+		{"stops after the end of the line", "ab\r\n=|1\r\n", false, 4, "=|1\r\n"},
+		{"skips lines when told to", "ab\r\n=|1\r\n\x02", true, 9, "\x02"},
+		{"nothing to skip", "\x02", false, 0, "\x02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(bytes.NewReader([]byte(tt.data)))
+			skipped, _ := skipToFrameStart(reader, tt.acrossLines)
+
+			if skipped != tt.wantSkipped {
+				t.Errorf("skipToFrameStart() skipped %d bytes, want %d", skipped, tt.wantSkipped)
+			}
+
+			remaining, _ := io.ReadAll(reader)
+			if string(remaining) != tt.wantRemaining {
+				t.Errorf("skipToFrameStart() left %q, want %q", remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
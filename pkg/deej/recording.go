@@ -0,0 +1,363 @@
+package deej
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// a recording captures everything that went over a single device connection, exactly as the transport read and
+// wrote it (before any parsing, so invalid frames and partial lines are kept too), one read or write per line:
+//
+//	# deej recording: device=default connection=serial:COM4@9600 started=2026-01-02T15:04:05Z
+//	+0.000 < "=|50|20|100\r\n=|5"
+//	+0.012 < "0|21|100\r\n"
+//	+0.184 > "<!0|40>"
+//
+// each line holds the time since the connection was established (in seconds), the direction ('<' for
+// device to host, '>' for host to device) and the raw bytes, quoted Go-style so frames survive intact
+const (
+	recordingFilenameFormat = "deej-recording-%s-%s.log"
+	recordingTimeFormat     = "20060102-150405"
+	recordingHeaderPrefix   = "# deej recording:"
+
+	recordingInbound  = "<"
+	recordingOutbound = ">"
+)
+
+type recordedMessage struct {
+	offset    time.Duration
+	direction string
+	data      []byte
+}
+
+// recordingTransport records everything that goes over another transport, at the byte level
+type recordingTransport struct {
+	Transport
+
+	logger     *zap.SugaredLogger
+	deviceName string
+
+	recorder *trafficRecorder // nil if the recording couldn't be started
+	inner    *bufio.Reader
+	reader   *bufio.Reader
+}
+
+// recordingReader feeds a recordingTransport's reader, recording each chunk it reads
+type recordingReader struct {
+	t *recordingTransport
+}
+
+func newRecordingTransport(logger *zap.SugaredLogger, deviceName string, transport Transport) *recordingTransport {
+	return &recordingTransport{
+		Transport:  transport,
+		logger:     logger,
+		deviceName: deviceName,
+	}
+}
+
+func (t *recordingTransport) Open() error {
+	if err := t.Transport.Open(); err != nil {
+		return err
+	}
+
+	// the recording is named after the connection, which is only known once it's open
+	recorder, err := newTrafficRecorder(t.logger, t.deviceName, t.Transport.String())
+	if err != nil {
+		t.logger.Warnw("Failed to start recording device traffic", "error", err)
+	}
+
+	t.recorder = recorder
+	t.inner = t.Transport.Reader()
+	t.reader = bufio.NewReader(recordingReader{t})
+
+	return nil
+}
+
+func (t *recordingTransport) Reader() *bufio.Reader {
+	return t.reader
+}
+
+func (t *recordingTransport) Write(data []byte) error {
+	t.record(recordingOutbound, data)
+	return t.Transport.Write(data)
+}
+
+func (t *recordingTransport) Close() error {
+	if t.recorder != nil {
+		t.recorder.close()
+	}
+
+	return t.Transport.Close()
+}
+
+func (t *recordingTransport) record(direction string, data []byte) {
+	if t.recorder != nil {
+		t.recorder.record(direction, data)
+	}
+}
+
+func (r recordingReader) Read(p []byte) (int, error) {
+	n, err := r.t.inner.Read(p)
+	if n > 0 {
+		r.t.record(recordingInbound, p[:n])
+	}
+
+	return n, err
+}
+
+// trafficRecorder writes a single connection's traffic to a recording file
+type trafficRecorder struct {
+	logger  *zap.SugaredLogger
+	file    *os.File
+	started time.Time
+	lock    sync.Mutex
+}
+
+func newTrafficRecorder(logger *zap.SugaredLogger, deviceName string, connectionName string) (*trafficRecorder, error) {
+	logger = logger.Named("recorder")
+
+	if err := util.EnsureDirExists(logDirectory); err != nil {
+		return nil, fmt.Errorf("ensure log directory exists: %w", err)
+	}
+
+	started := time.Now()
+	path := filepath.Join(logDirectory, fmt.Sprintf(recordingFilenameFormat, deviceName, started.Format(recordingTimeFormat)))
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create recording file: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(file, "%s device=%s connection=%s started=%s\n",
+		recordingHeaderPrefix, deviceName, connectionName, started.Format(time.RFC3339)); err != nil {
+
+		file.Close()
+		return nil, fmt.Errorf("write recording header: %w", err)
+	}
+
+	logger.Infow("Recording device traffic", "path", path)
+
+	return &trafficRecorder{
+		logger:  logger,
+		file:    file,
+		started: started,
+	}, nil
+}
+
+func (r *trafficRecorder) record(direction string, data []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return
+	}
+
+	offset := time.Since(r.started).Seconds()
+
+	if _, err := fmt.Fprintf(r.file, "+%.3f %s %s\n", offset, direction, strconv.Quote(string(data))); err != nil {
+		r.logger.Warnw("Failed to write to recording, stopping", "error", err)
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+func (r *trafficRecorder) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return
+	}
+
+	if err := r.file.Close(); err != nil {
+		r.logger.Warnw("Failed to close recording", "error", err)
+	}
+
+	r.file = nil
+}
+
+// readRecording parses a recording file, returning the name of the device it was recorded from and its messages
+func readRecording(path string) (string, []recordedMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("open recording: %w", err)
+	}
+
+	defer file.Close()
+
+	var (
+		deviceName = defaultDeviceName
+		messages   = []recordedMessage{}
+		scanner    = bufio.NewScanner(file)
+		lineNumber = 0
+	)
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, recordingHeaderPrefix) {
+			for _, field := range strings.Fields(strings.TrimPrefix(line, recordingHeaderPrefix)) {
+				if value := strings.TrimPrefix(field, "device="); value != field {
+					deviceName = value
+				}
+			}
+
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) != 3 {
+			return "", nil, fmt.Errorf("recording line %d: expected offset, direction and data", lineNumber)
+		}
+
+		offset, err := strconv.ParseFloat(strings.TrimPrefix(parts[0], "+"), 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("recording line %d: invalid offset: %w", lineNumber, err)
+		}
+
+		if parts[1] != recordingInbound && parts[1] != recordingOutbound {
+			return "", nil, fmt.Errorf("recording line %d: invalid direction %q", lineNumber, parts[1])
+		}
+
+		data, err := strconv.Unquote(parts[2])
+		if err != nil {
+			return "", nil, fmt.Errorf("recording line %d: invalid data: %w", lineNumber, err)
+		}
+
+		messages = append(messages, recordedMessage{
+			offset:    time.Duration(offset * float64(time.Second)),
+			direction: parts[1],
+			data:      []byte(data),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", nil, fmt.Errorf("read recording: %w", err)
+	}
+
+	return deviceName, messages, nil
+}
+
+// ReplayOptions describe a recording to play back in place of a device connection
+type ReplayOptions struct {
+	Path string
+
+	// 1 plays the recording at its original pace, 2 twice as fast and so on. 0 plays it without any delays
+	Speed float64
+}
+
+// replayTransport plays back a recording's inbound messages as if a device sent them. whatever deej sends
+// is thrown away. once the recording is over, the connection stays open (and quiet) until closed
+type replayTransport struct {
+	logger  *zap.SugaredLogger
+	options ReplayOptions
+
+	reader *bufio.Reader
+	pipe   *io.PipeReader
+	done   chan struct{}
+}
+
+func (t *replayTransport) Open() error {
+	_, messages, err := readRecording(t.options.Path)
+	if err != nil {
+		return fmt.Errorf("open replay transport: %w", err)
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+
+	t.pipe = pipeReader
+	t.reader = bufio.NewReader(pipeReader)
+	t.done = make(chan struct{})
+
+	t.logger.Infow("Replaying recording", "path", t.options.Path, "messages", len(messages), "speed", t.options.Speed)
+
+	go func() {
+		defer pipeWriter.Close()
+
+		started := time.Now()
+
+		for _, message := range messages {
+			if message.direction != recordingInbound {
+				continue
+			}
+
+			if t.options.Speed > 0 {
+				due := started.Add(time.Duration(float64(message.offset) / t.options.Speed))
+				select {
+				case <-time.After(time.Until(due)):
+				case <-t.done:
+					return
+				}
+			}
+
+			if _, err := pipeWriter.Write(message.data); err != nil {
+				return
+			}
+		}
+
+		t.logger.Info("Replay finished")
+
+		<-t.done
+	}()
+
+	return nil
+}
+
+func (t *replayTransport) Reader() *bufio.Reader {
+	return t.reader
+}
+
+func (t *replayTransport) Write(data []byte) error {
+	if t.pipe == nil {
+		return errTransportClosed
+	}
+
+	return nil
+}
+
+func (t *replayTransport) Close() error {
+	if t.pipe == nil {
+		return errTransportClosed
+	}
+
+	close(t.done)
+	err := t.pipe.Close()
+	t.pipe = nil
+
+	return err
+}
+
+func (t *replayTransport) String() string {
+	return fmt.Sprintf("replay:%s", filepath.Base(t.options.Path))
+}
+
+// checkReplayOptions validates a replay's options and returns the name of the device it was recorded from
+func checkReplayOptions(options ReplayOptions) (string, error) {
+	if options.Speed < 0 {
+		return "", errors.New("replay: speed can't be negative")
+	}
+
+	deviceName, _, err := readRecording(options.Path)
+	if err != nil {
+		return "", err
+	}
+
+	return deviceName, nil
+}
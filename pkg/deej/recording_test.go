@@ -0,0 +1,80 @@
+package deej
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadRecording(t *testing.T) {
+	tests := []struct {
+		name         string
+		contents     string
+		wantDevice   string
+		wantMessages []recordedMessage
+		wantErr      bool
+	}{
+		{
+			name: "chunks in both directions",
+			contents: "# deej recording: device=desk connection=serial:COM4@9600 started=2026-01-02T15:04:05Z\n" +
+				"+0.000 < \"=|50|20|100\\r\\n=|5\"\n" +
+				"+0.012 < \"0|21|100\\r\\n\"\n" +
+				"\n" +
+				"# a comment\n" +
+				"+0.184 > \"<!0|40>\"\n",
+			wantDevice: "desk",
+			wantMessages: []recordedMessage{
+				{offset: 0, direction: recordingInbound, data: []byte("=|50|20|100\r\n=|5")},
+				{offset: 12 * time.Millisecond, direction: recordingInbound, data: []byte("0|21|100\r\n")},
+				{offset: 184 * time.Millisecond, direction: recordingOutbound, data: []byte("<!0|40>")},
+			},
+		},
+		{
+			name:       "frames survive intact",
+			contents:   "+0.5 < \"\\x02\\x01\\x05\\x00\\x04Y\"\n",
+			wantDevice: defaultDeviceName,
+			wantMessages: []recordedMessage{
+				{offset: 500 * time.Millisecond, direction: recordingInbound, data: []byte{0x02, 0x01, 0x05, 0x00, 0x04, 0x59}},
+			},
+		},
+		{
+			name:         "no header",
+			contents:     "",
+			wantDevice:   defaultDeviceName,
+			wantMessages: []recordedMessage{},
+		},
+		{name: "missing data", contents: "+0.000 <\n", wantErr: true},
+		{name: "invalid offset", contents: "+soon < \"=|1\"\n", wantErr: true},
+		{name: "invalid direction", contents: "+0.000 ? \"=|1\"\n", wantErr: true},
+		{name: "unquoted data", contents: "+0.000 < =|1\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "recording.log")
+			if err := os.WriteFile(path, []byte(tt.contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			device, messages, err := readRecording(path)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readRecording() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if device != tt.wantDevice {
+				t.Errorf("readRecording() device = %q, want %q", device, tt.wantDevice)
+			}
+
+			if !reflect.DeepEqual(messages, tt.wantMessages) {
+				t.Errorf("readRecording() messages = %+v, want %+v", messages, tt.wantMessages)
+			}
+		})
+	}
+}
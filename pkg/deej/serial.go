@@ -1,93 +1,153 @@
 package deej
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"go.bug.st/serial"
 	"go.uber.org/zap"
 
 	"github.com/omriharel/deej/pkg/deej/util"
 )
 
-// SerialIO provides a deej-aware abstraction layer to managing serial I/O
+// SerialIO provides a deej-aware abstraction layer to managing serial I/O.
+// The actual bytes travel over a Transport, which is usually (but not necessarily) a serial port
 type SerialIO struct {
-	comPort  string
-	baudRate uint
+	deviceName     string
+	connectionInfo ConnectionInfo
 
 	deej   *Deej
 	logger *zap.SugaredLogger
 
-	stopChannel chan bool
-	connected   bool
-	conn        serial.Port
+	// the current connection. the reader goroutine sets these up and tears them down, while anything else
+	// may look at them, so they're only touched under connectionLock. Stop closes stopChannel to end the connection
+	connected      bool
+	transport      Transport
+	stopChannel    chan bool
+	connectionLock sync.Mutex
+
+	// host messages are written by this queue's goroutine only, and it lives as long as the connection
+	queue *commandQueue
+
+	// when recording, each connection's traffic goes to its own recording file
+	recordTraffic bool
+
+	// when set, connections use the transport this returns instead of the configured one
+	// (e.g. to play back a recording, or to talk to a simulated mixer)
+	transportOverride func() Transport
+
+	// set (by the reader) once the device has agreed to speak the framed protocol on this connection,
+	// and read by the queue's writer
+	framed        atomic.Bool
+	corruptFrames int
+
+	// nil until the device reports its capabilities on this connection. set by the reader, read from anywhere
+	capabilities     *DeviceCapabilities
+	capabilitiesLock sync.Mutex
+
+	// diagnostic messages the device printed, counted by kind across connections
+	deviceEventCounts map[DeviceEventKind]int
+	deviceEventLock   sync.Mutex
+
+	// displays we've already told the user about on this connection
+	notifiedDisplayFailures map[int]bool
 
 	lastKnownNumSliders        int
 	currentSliderPercentValues []float32
+	sliderFilters              []*sliderFilterChain
+
+	// guards the slider values and filters, which are used by the reader and by settleSliders
+	sliderLock  sync.Mutex
+	settleTimer *time.Timer
 
-	sliderMoveConsumers []chan SliderMoveEvent
-	reconnectNotifiers  []chan bool
+	sliderMoveConsumers  []chan SliderMoveEvent
+	reconnectNotifiers   []chan bool
+	connectionConsumers  []chan string
+	deviceEventConsumers []chan DeviceEvent
 
-	reconnectTicker *time.Ticker
-	stopTicker      chan bool
+	// the reconnect loop runs from Start until Stop (which closes stopReconnecting), and hears about lost
+	// connections through disconnected
+	disconnected     chan bool
+	stopReconnecting chan bool
 
+	// failed reconnection attempts since the connection was lost
 	retryCount int
 	maxRetries int
 }
 
 // SliderMoveEvent represents a single slider move captured by deej
 type SliderMoveEvent struct {
+	Device       string
 	SliderID     int
 	PercentValue float32
 	Command      string
 }
 
+const (
+
+	// reconnection attempts start this far apart and back off exponentially
+	reconnectMinDelay = 1 * time.Second
+	reconnectMaxDelay = 30 * time.Second
+
+	// a device node that just appeared might not be openable until udev is done with it
+	hotplugSettleDelay = 500 * time.Millisecond
+
+	// while a slider's filters are still catching up with its last reading, that reading is fed to them this often
+	sliderSettleInterval = 20 * time.Millisecond
+)
+
 var expectedLinePattern = regexp.MustCompile(`^(\d{1,4}|[=\+\^\-])(\|(\d{1,4}|[=\+\^\-]))*\r\n$`)
 
-// NewSerialIO creates a SerialIO instance that uses the provided deej
-// instance's connection info to establish communications with the arduino chip
-func NewSerialIO(deej *Deej, logger *zap.SugaredLogger) (*SerialIO, error) {
+// NewSerialIO creates a SerialIO instance that uses the connection info of the provided deej
+// instance's given device to establish communications with its arduino chip
+func NewSerialIO(deej *Deej, logger *zap.SugaredLogger, deviceName string) (*SerialIO, error) {
 	logger = logger.Named("serial")
+	if deviceName != defaultDeviceName {
+		logger = logger.Named(deviceName)
+	}
+
+	device, ok := deej.config.Device(deviceName)
+	if !ok {
+		return nil, fmt.Errorf("serial: unknown device %q", deviceName)
+	}
 
 	// Log the connection info from the config
 	logger.Debugw("Connection info from config",
-		"comPort", deej.config.ConnectionInfo.COMPort,
-		"baudRate", deej.config.ConnectionInfo.BaudRate)
+		"transport", device.ConnectionInfo.Transport,
+		"comPort", device.ConnectionInfo.COMPort,
+		"baudRate", device.ConnectionInfo.BaudRate)
 
 	// Check if the values are empty or zero
-	if deej.config.ConnectionInfo.COMPort == "" {
-		logger.Warn("COM port is empty in config, using default COM4")
-		deej.config.ConnectionInfo.COMPort = "COM5"
+	if device.ConnectionInfo.COMPort == "" {
+		logger.Warnw("COM port is empty in config, using default", "default", defaultCOMPort)
+		device.ConnectionInfo.COMPort = defaultCOMPort
 	}
 
-	if deej.config.ConnectionInfo.BaudRate == 0 {
+	if device.ConnectionInfo.BaudRate == 0 {
 		logger.Warn("Baud rate is zero in config, using default 9600")
-		deej.config.ConnectionInfo.BaudRate = 9600
+		device.ConnectionInfo.BaudRate = 9600
 	}
 
 	sio := &SerialIO{
+		deviceName:          deviceName,
 		deej:                deej,
 		logger:              logger,
-		stopChannel:         make(chan bool),
-		connected:           false,
-		conn:                nil,
 		sliderMoveConsumers: []chan SliderMoveEvent{},
-		reconnectTicker:     time.NewTicker(30 * time.Second),
-		stopTicker:          make(chan bool),
+		deviceEventCounts:   make(map[DeviceEventKind]int),
+		disconnected:        make(chan bool, 1),
 		maxRetries:          5,
-		comPort:             deej.config.ConnectionInfo.COMPort,
-		baudRate:            uint(deej.config.ConnectionInfo.BaudRate),
+		connectionInfo:      device.ConnectionInfo,
 	}
 
 	// Log the values after setting them
-	logger.Debugw("Created serial i/o instance",
-		"comPort", sio.comPort,
-		"baudRate", sio.baudRate)
+	logger.Debugw("Created serial i/o instance", "connectionInfo", sio.connectionInfo)
 
 	// respond to config changes
 	sio.setupOnConfigReload()
@@ -95,53 +155,144 @@ func NewSerialIO(deej *Deej, logger *zap.SugaredLogger) (*SerialIO, error) {
 	return sio, nil
 }
 
-// Start attempts to connect to our arduino chip
+// Start attempts to connect to our arduino chip. Whether or not that succeeds, deej keeps
+// trying to (re)connect whenever there's no connection, until Stop is called
 func (sio *SerialIO) Start() error {
 
 	// don't allow multiple concurrent connections
-	if sio.connected {
+	if sio.isConnected() {
 		sio.logger.Warn("Already connected, can't start another without closing first")
 		return errors.New("serial: connection already active")
 	}
 
-	if err := sio.connect(); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	// forget about connections lost before we were last stopped
+	select {
+	case <-sio.disconnected:
+	default:
 	}
 
-	// Add reconnection goroutine
-	go func() {
-		for {
-			select {
-			case <-sio.reconnectTicker.C:
-				if !sio.connected {
-					sio.logger.Debug("Attempting to reconnect...")
-					if err := sio.connect(); err != nil {
-						sio.logger.Warnw("Failed to reconnect", "error", err)
-					} else {
-						sio.logger.Info("Reconnection successful")
-					}
-				}
-			case <-sio.stopTicker:
-				sio.reconnectTicker.Stop()
-				return
-			}
-		}
-	}()
+	sio.retryCount = 0
+	err := sio.connect()
+
+	// a previous loop would've been stopped already, but make sure there's only ever one
+	if sio.stopReconnecting != nil {
+		close(sio.stopReconnecting)
+	}
+
+	sio.stopReconnecting = make(chan bool)
+	go sio.reconnectLoop(err != nil, sio.stopReconnecting)
+
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
 
 	return nil
 }
 
 // Stop signals us to shut down our serial connection, if one is active
 func (sio *SerialIO) Stop() {
-	sio.stopTicker <- true
-	if sio.connected {
+	if sio.stopReconnecting != nil {
+		close(sio.stopReconnecting)
+		sio.stopReconnecting = nil
+	}
+
+	// the reader only notices this between reads, so don't wait around for it
+	sio.connectionLock.Lock()
+	stop := sio.stopChannel
+	sio.stopChannel = nil
+	sio.connectionLock.Unlock()
+
+	if stop != nil {
 		sio.logger.Debug("Shutting down serial connection")
-		sio.stopChannel <- true
+		close(stop)
 	} else {
 		sio.logger.Debug("Not currently connected, nothing to stop")
 	}
 }
 
+// reconnectLoop waits for the connection to drop and then attempts to re-establish it, with exponential
+// backoff between attempts. on Linux, a serial device node appearing triggers an attempt right away
+func (sio *SerialIO) reconnectLoop(disconnected bool, stop chan bool) {
+	logger := sio.logger.Named("reconnect")
+
+	var hotplug chan string
+
+	if sio.connectionInfo.Transport == transportSerial || sio.connectionInfo.Transport == "" {
+		stopWatching := make(chan struct{})
+		defer close(stopWatching)
+
+		nodes, err := watchDeviceNodes(logger, stopWatching)
+		if err != nil {
+			logger.Debugw("Not watching for device nodes, relying on backoff alone", "error", err)
+		}
+
+		// stays nil (and never fires) if we aren't watching
+		hotplug = nodes
+	}
+
+	for {
+		if !disconnected {
+			select {
+			case <-sio.disconnected:
+				if sio.isConnected() {
+					continue
+				}
+
+				logger.Info("Lost connection to device, will try to reconnect")
+				disconnected = true
+			case <-stop:
+				return
+			}
+		}
+
+		delay := reconnectDelay(sio.retryCount)
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case node := <-hotplug:
+			timer.Stop()
+			logger.Debugw("Device node appeared, attempting to reconnect", "node", node)
+			time.Sleep(hotplugSettleDelay)
+		case <-stop:
+			timer.Stop()
+			return
+		}
+
+		if err := sio.connect(); err != nil {
+			sio.retryCount++
+			logger.Debugw("Failed to reconnect",
+				"attempt", sio.retryCount,
+				"nextAttemptIn", reconnectDelay(sio.retryCount),
+				"error", err)
+
+			if sio.retryCount == sio.maxRetries {
+				sio.notifyReconnectFailed()
+			}
+
+			continue
+		}
+
+		disconnected = false
+		sio.notifyReconnected()
+		sio.retryCount = 0
+	}
+}
+
+func reconnectDelay(retryCount int) time.Duration {
+	delay := reconnectMinDelay
+
+	for attempt := 0; attempt < retryCount && delay < reconnectMaxDelay; attempt++ {
+		delay *= 2
+	}
+
+	if delay > reconnectMaxDelay {
+		delay = reconnectMaxDelay
+	}
+
+	return delay
+}
+
 // SubscribeToSliderMoveEvents returns an unbuffered channel that receives
 // a sliderMoveEvent struct every time a slider moves
 func (sio *SerialIO) SubscribeToSliderMoveEvents() chan SliderMoveEvent {
@@ -167,12 +318,22 @@ func (sio *SerialIO) setupOnConfigReload() {
 				// is still cleared. this is kind of ugly, but shouldn't cause any issues
 				go func() {
 					<-time.After(stopDelay)
+
+					sio.sliderLock.Lock()
 					sio.lastKnownNumSliders = 0
+					sio.sliderLock.Unlock()
 				}()
 
+				sio.validateSliderMapping()
+
+				device, ok := sio.deej.config.Device(sio.deviceName)
+				if !ok {
+					sio.logger.Warn("Device removed from config, restart deej to disconnect from it")
+					continue
+				}
+
 				// if connection params have changed, attempt to stop and start the connection
-				if sio.deej.config.ConnectionInfo.COMPort != sio.comPort ||
-					uint(sio.deej.config.ConnectionInfo.BaudRate) != sio.baudRate {
+				if !reflect.DeepEqual(device.ConnectionInfo, sio.connectionInfo) {
 
 					sio.logger.Info("Detected change in connection parameters, attempting to renew connection")
 					sio.Stop()
@@ -180,10 +341,13 @@ func (sio *SerialIO) setupOnConfigReload() {
 					// let the connection close
 					<-time.After(stopDelay)
 
+					sio.connectionInfo = device.ConnectionInfo
+
 					if err := sio.Start(); err != nil {
 						sio.logger.Warnw("Failed to renew connection after parameter change", "error", err)
 					} else {
 						sio.logger.Debug("Renewed connection successfully")
+						sio.notifyReconnected()
 					}
 				}
 			}
@@ -191,42 +355,374 @@ func (sio *SerialIO) setupOnConfigReload() {
 	}()
 }
 
+// close tears down the current connection. the queue's writer is stopped before the transport is closed,
+// so that it never writes to a closed transport
 func (sio *SerialIO) close(logger *zap.SugaredLogger) {
-	if err := sio.conn.Close(); err != nil {
+	sio.connectionLock.Lock()
+	queue, transport := sio.queue, sio.transport
+	sio.queue = nil
+	sio.transport = nil
+	sio.stopChannel = nil
+	sio.connected = false
+	sio.connectionLock.Unlock()
+
+	if queue != nil {
+		queue.stop()
+	}
+
+	if transport == nil {
+		return
+	}
+
+	if err := transport.Close(); err != nil {
 		logger.Warnw("Failed to close serial connection", "error", err)
 	} else {
 		logger.Debug("Serial connection closed")
 	}
+}
 
-	sio.conn = nil
-	sio.connected = false
+func (sio *SerialIO) isConnected() bool {
+	sio.connectionLock.Lock()
+	defer sio.connectionLock.Unlock()
+
+	return sio.connected
+}
+
+// currentQueue returns the current connection's queue, or nil if there's no connection
+func (sio *SerialIO) currentQueue() *commandQueue {
+	sio.connectionLock.Lock()
+	defer sio.connectionLock.Unlock()
+
+	return sio.queue
 }
 
 func (sio *SerialIO) handleLine(logger *zap.SugaredLogger, line string) {
 
 	//logger.Infow("Got line", "line", line)
 
+	if strings.HasPrefix(line, ackLinePrefix) {
+		sio.handleTextAck(logger, strings.TrimSpace(strings.TrimPrefix(line, ackLinePrefix)))
+		return
+	}
+
+	if strings.HasPrefix(line, capabilitiesLinePrefix) {
+		sio.handleCapabilities(logger, line)
+		return
+	}
+
 	if !expectedLinePattern.MatchString(line) {
+		if strings.TrimSpace(line) != "" {
+			sio.handleDeviceEvent(logger, parseDeviceEvent(sio.deviceName, line))
+		}
+
+		return
+	}
+
+	// once the device speaks framed, slider values only come in frames. a text line that looks like one is
+	// most likely what's left of a corrupt frame, and acting on it would move a slider to some random value
+	if sio.framed.Load() {
+		logger.Debugw("Ignoring text slider line from framed device", "line", strings.TrimSpace(line))
 		return
 	}
 
 	line = strings.TrimSuffix(line, "\r\n")
-	splitLine := strings.Split(line, "|")
-	numSliders := len(splitLine)
+	sio.handleSliderFields(logger, strings.Split(line, "|"))
+}
+
+func (sio *SerialIO) handleFrame(logger *zap.SugaredLogger, f frame) {
+	switch f.frameType {
+	case frameTypeHello:
+		if sio.framed.CompareAndSwap(false, true) {
+			logger.Infow("Device switched to framed protocol", "version", protocolVersion)
+		}
+
+		sio.settleMessage('~')
+
+	case frameTypeSliders:
+		fields, err := decodeSliderPayload(f.payload)
+		if err != nil {
+			logger.Debugw("Got malformed sliders frame, ignoring", "error", err)
+			return
+		}
+
+		sio.handleSliderFields(logger, fields)
+
+	case frameTypeLog:
+		sio.handleDeviceEvent(logger, parseDeviceEvent(sio.deviceName, string(f.payload)))
+
+	case frameTypeCaps:
+		sio.handleCapabilities(logger, string(f.payload))
+
+	case frameTypeAck:
+		kind, ok := frameTypeMessageKinds[f.payload[0]]
+		if !ok {
+			logger.Debugw("Got ack for unknown frame type, ignoring", "type", f.payload[0])
+			return
+		}
+
+		sio.handleAck(kind, uint16(f.payload[1])<<8|uint16(f.payload[2]))
+
+	default:
+		logger.Debugw("Got frame of unknown type, ignoring", "type", f.frameType)
+	}
+}
+
+func (sio *SerialIO) handleCapabilities(logger *zap.SugaredLogger, report string) {
+	caps, err := parseCapabilities(report)
+	if err != nil {
+		logger.Warnw("Got malformed capabilities report, ignoring", "error", err)
+		return
+	}
+
+	logger.Infow("Device reported capabilities", "capabilities", caps)
+	sio.setCapabilities(&caps)
+
+	// the report itself is the reply to our request, whether or not the device acknowledges messages
+	sio.settleMessage('?')
+
+	sio.validateSliderMapping()
+}
+
+func (sio *SerialIO) handleDeviceEvent(logger *zap.SugaredLogger, event DeviceEvent) {
+	sio.deviceEventLock.Lock()
+	sio.deviceEventCounts[event.Kind]++
+	count := sio.deviceEventCounts[event.Kind]
+	sio.deviceEventLock.Unlock()
+
+	if event.IsProblem() {
+		logger.Warnw("Device reported a problem", "kind", event.Kind, "message", event.Message, "count", count)
+	} else {
+		logger.Debugw("Device log", "kind", event.Kind, "message", event.Message)
+	}
+
+	// a dead display usually stays dead until someone checks the wiring, so only say it once per connection
+	if event.Kind == DeviceEventDisplayFailure && !sio.notifiedDisplayFailures[event.DisplayID] {
+		sio.notifiedDisplayFailures[event.DisplayID] = true
+
+		sio.deej.notifier.Notify("Display not working!",
+			fmt.Sprintf("Display %d on your %s device failed to start. Check its wiring.", event.DisplayID, sio.deviceName))
+	}
+
+	for _, consumer := range sio.deviceEventConsumers {
+		select {
+		case consumer <- event:
+		default:
+		}
+	}
+}
+
+// DeviceEventCounts returns how many diagnostic messages of each kind the device has printed since deej started
+func (sio *SerialIO) DeviceEventCounts() map[DeviceEventKind]int {
+	sio.deviceEventLock.Lock()
+	defer sio.deviceEventLock.Unlock()
+
+	counts := make(map[DeviceEventKind]int, len(sio.deviceEventCounts))
+	for kind, count := range sio.deviceEventCounts {
+		counts[kind] = count
+	}
+
+	return counts
+}
+
+// SubscribeToDeviceEvents returns a buffered channel that receives every diagnostic message the device prints
+func (sio *SerialIO) SubscribeToDeviceEvents() chan DeviceEvent {
+	ch := make(chan DeviceEvent, 32)
+	sio.deviceEventConsumers = append(sio.deviceEventConsumers, ch)
+	return ch
+}
+
+// handleTextAck handles the text form of an ack, which is the message's kind followed by its checksum in hex
+func (sio *SerialIO) handleTextAck(logger *zap.SugaredLogger, ack string) {
+	if len(ack) != 1+ackChecksumLen {
+		logger.Debugw("Got malformed ack, ignoring", "ack", ack)
+		return
+	}
+
+	checksum, err := strconv.ParseUint(ack[1:], 16, 16)
+	if err != nil {
+		logger.Debugw("Got malformed ack, ignoring", "ack", ack)
+		return
+	}
+
+	sio.handleAck(ack[0], uint16(checksum))
+}
+
+func (sio *SerialIO) handleAck(kind byte, checksum uint16) {
+	if queue := sio.currentQueue(); queue != nil {
+		queue.acknowledge(kind, checksum)
+	}
+}
+
+// settleMessage stops waiting for a reply to the in-flight message of the given kind
+func (sio *SerialIO) settleMessage(kind byte) {
+	if queue := sio.currentQueue(); queue != nil {
+		queue.settle(kind)
+	}
+}
+
+// Capabilities returns the hardware layout reported by the currently connected device.
+// The second return value is false if the device hasn't reported one (older firmware doesn't)
+func (sio *SerialIO) Capabilities() (DeviceCapabilities, bool) {
+	sio.capabilitiesLock.Lock()
+	defer sio.capabilitiesLock.Unlock()
+
+	if sio.capabilities == nil {
+		return DeviceCapabilities{}, false
+	}
+
+	return *sio.capabilities, true
+}
+
+func (sio *SerialIO) setCapabilities(caps *DeviceCapabilities) {
+	sio.capabilitiesLock.Lock()
+	defer sio.capabilitiesLock.Unlock()
+
+	sio.capabilities = caps
+}
+
+// hasDisplays reports whether the device can show any feedback we send it. devices that haven't
+// reported their capabilities are assumed to be like the deejx sketch, which has displays
+func (sio *SerialIO) hasDisplays() bool {
+	caps, ok := sio.Capabilities()
+	return !ok || caps.Displays > 0
+}
+
+// validateSliderMapping warns about mapped slider indices that the connected device doesn't have
+func (sio *SerialIO) validateSliderMapping() {
+	caps, ok := sio.Capabilities()
+	if !ok {
+		return
+	}
+
+	device, ok := sio.deej.config.Device(sio.deviceName)
+	if !ok {
+		return
+	}
+
+	invalidIndices := []int{}
+
+	device.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+		if sliderIdx < 0 || sliderIdx >= len(caps.Controls) {
+			invalidIndices = append(invalidIndices, sliderIdx)
+		}
+	})
+
+	if len(invalidIndices) == 0 {
+		return
+	}
+
+	sort.Ints(invalidIndices)
+
+	sio.logger.Warnw("Slider mapping references controls the device doesn't have",
+		"indices", invalidIndices,
+		"deviceControls", len(caps.Controls))
+
+	sio.deej.notifier.Notify("Check your slider mapping!",
+		fmt.Sprintf("Your %s device has %d controls, but %s maps slider %d.",
+			sio.deviceName, len(caps.Controls), userConfigFilepath, invalidIndices[len(invalidIndices)-1]))
+}
+
+// mappedControls returns how many controls the device needs to have for its whole slider mapping to work
+func (sio *SerialIO) mappedControls() int {
+	device, ok := sio.deej.config.Device(sio.deviceName)
+	if !ok {
+		return 0
+	}
+
+	controls := 0
+
+	device.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+		if sliderIdx+1 > controls {
+			controls = sliderIdx + 1
+		}
+	})
+
+	return controls
+}
+
+func (sio *SerialIO) handleSliderFields(logger *zap.SugaredLogger, fields []string) {
+	sio.sliderLock.Lock()
+	sio.updateSliderCount(logger, len(fields))
+	moveEvents := sio.processSliderValues(logger, fields)
+	sio.scheduleSliderSettle()
+	sio.sliderLock.Unlock()
+
+	sio.deliverMoveEvents(moveEvents)
+}
+
+// scheduleSliderSettle makes sure settleSliders runs soon if any slider's filters haven't settled yet.
+// assumes sliderLock is held
+func (sio *SerialIO) scheduleSliderSettle() {
+	if sio.settleTimer != nil {
+		return
+	}
+
+	for _, filter := range sio.sliderFilters {
+		if !filter.settled() {
+			sio.settleTimer = time.AfterFunc(sliderSettleInterval, sio.settleSliders)
+			return
+		}
+	}
+}
+
+// settleSliders feeds the last reading of every slider whose filters haven't settled back into them,
+// so that a slider that stopped moving still ends up where it stopped
+func (sio *SerialIO) settleSliders() {
+	moveEvents := []SliderMoveEvent{}
+
+	sio.sliderLock.Lock()
+	sio.settleTimer = nil
+
+	for sliderIdx, filter := range sio.sliderFilters {
+		if filter.settled() {
+			continue
+		}
+
+		value, significant := filter.settle()
+		if !significant {
+			continue
+		}
+
+		sio.currentSliderPercentValues[sliderIdx] = value
+		moveEvents = append(moveEvents, SliderMoveEvent{
+			Device:       sio.deviceName,
+			SliderID:     sliderIdx,
+			PercentValue: value,
+			Command:      "=",
+		})
+	}
+
+	sio.scheduleSliderSettle()
+	sio.sliderLock.Unlock()
 
-	sio.updateSliderCount(logger, numSliders)
-	moveEvents := sio.processSliderValues(logger, splitLine)
 	sio.deliverMoveEvents(moveEvents)
 }
 
 func (sio *SerialIO) updateSliderCount(logger *zap.SugaredLogger, numSliders int) {
 	if numSliders != sio.lastKnownNumSliders {
 		logger.Infow("Detected sliders", "amount", numSliders)
+
+		if caps, ok := sio.Capabilities(); ok && len(caps.Controls) != numSliders {
+			logger.Warnw("Device sent a different number of values than it reported controls",
+				"values", numSliders,
+				"controls", len(caps.Controls))
+		}
+
 		sio.lastKnownNumSliders = numSliders
 		sio.currentSliderPercentValues = make([]float32, numSliders)
+		sio.sliderFilters = make([]*sliderFilterChain, numSliders)
+
+		device, _ := sio.deej.config.Device(sio.deviceName)
 
 		for idx := range sio.currentSliderPercentValues {
 			sio.currentSliderPercentValues[idx] = -1.0
+
+			filter := sliderFilterPresets[noiseReductionDefault]
+			if device != nil {
+				filter = device.SliderFilter(idx)
+			}
+
+			sio.sliderFilters[idx] = newSliderFilterChain(filter)
 		}
 	}
 }
@@ -234,6 +730,17 @@ func (sio *SerialIO) updateSliderCount(logger *zap.SugaredLogger, numSliders int
 func (sio *SerialIO) processSliderValues(logger *zap.SugaredLogger, splitLine []string) []SliderMoveEvent {
 	moveEvents := []SliderMoveEvent{}
 
+	// devices that reported their capabilities tell us which fields belong to encoders and buttons (commands only)
+	// and which belong to sliders (positions only). for the rest, only the first field can be told apart
+	caps, hasCaps := sio.Capabilities()
+	controlKind := func(sliderIdx int) ControlKind {
+		if hasCaps && sliderIdx < len(caps.Controls) {
+			return caps.Controls[sliderIdx]
+		}
+
+		return 0
+	}
+
 	for sliderIdx, stringValue := range splitLine {
 
 		// skip to other values if first value is "="
@@ -243,7 +750,13 @@ func (sio *SerialIO) processSliderValues(logger *zap.SugaredLogger, splitLine []
 
 		// if the value is a special character, handle it
 		if stringValue == "+" || stringValue == "-" || stringValue == "^" {
+			if controlKind(sliderIdx) == ControlSlider {
+				logger.Debugw("Got command for a slider, ignoring", "slider", sliderIdx, "command", stringValue)
+				continue
+			}
+
 			moveEvents = append(moveEvents, SliderMoveEvent{
+				Device:       sio.deviceName,
 				SliderID:     sliderIdx,
 				PercentValue: 1.0,
 				Command:      stringValue,
@@ -257,8 +770,13 @@ func (sio *SerialIO) processSliderValues(logger *zap.SugaredLogger, splitLine []
 
 		number, _ := strconv.Atoi(stringValue)
 
-		// Error if master volume > 100
-		if sliderIdx == 0 && number > 100 {
+		switch kind := controlKind(sliderIdx); {
+		case kind == ControlEncoder || kind == ControlButton:
+			logger.Debugw("Got position for a control that isn't a slider, ignoring", "control", sliderIdx, "kind", kind)
+			continue
+
+		// Error if master volume > 100 (or, for devices that told us which fields are sliders, any slider)
+		case number > 100 && (sliderIdx == 0 || kind == ControlSlider):
 			logger.Debugw("Got malformed line from serial, ignoring", "line", strings.Join(splitLine, "|"))
 			return moveEvents
 		}
@@ -266,9 +784,15 @@ func (sio *SerialIO) processSliderValues(logger *zap.SugaredLogger, splitLine []
 		// Convert percentage to 0 - 1
 		normalizedScalar := sio.calculateNormalizedValue(number)
 
-		//if util.SignificantlyDifferent(sio.currentSliderPercentValues[sliderIdx], normalizedScalar, sio.deej.config.NoiseReductionLevel) {
+		// drop jitter that the slider's filters don't consider an actual move
+		normalizedScalar, significant := sio.sliderFilters[sliderIdx].process(normalizedScalar)
+		if !significant {
+			continue
+		}
+
 		sio.currentSliderPercentValues[sliderIdx] = normalizedScalar
 		moveEvents = append(moveEvents, SliderMoveEvent{
+			Device:       sio.deviceName,
 			SliderID:     sliderIdx,
 			PercentValue: normalizedScalar,
 			Command:      "=",
@@ -304,98 +828,260 @@ func (sio *SerialIO) deliverMoveEvents(moveEvents []SliderMoveEvent) {
 }
 
 func (sio *SerialIO) connect() error {
-	sio.logger.Debugw("Attempting to connect", "comPort", sio.comPort, "baudRate", sio.baudRate)
+	var transport Transport
+
+	if sio.transportOverride != nil {
+		transport = sio.transportOverride()
+	} else {
+		var err error
+		if transport, err = newTransport(sio.logger, sio.connectionInfo, sio.mappedControls()); err != nil {
+			return fmt.Errorf("create transport: %w", err)
+		}
+	}
 
-	// Configure serial port
-	mode := &serial.Mode{
-		BaudRate: int(sio.baudRate),
-		DataBits: 8,
-		Parity:   serial.NoParity,
-		StopBits: serial.OneStopBit,
+	// recording happens right at the transport, so that it captures exactly what went over it
+	if sio.recordTraffic {
+		transport = newRecordingTransport(sio.logger, sio.deviceName, transport)
 	}
 
-	// Open the port
-	conn, err := serial.Open(sio.comPort, mode)
-	if err != nil {
-		return fmt.Errorf("failed to open serial port: %w", err)
+	sio.logger.Debugw("Attempting to connect", "transport", transport)
+
+	if err := transport.Open(); err != nil {
+		return fmt.Errorf("failed to open %s transport: %w", sio.connectionInfo.Transport, err)
 	}
 
-	sio.conn = conn
+	sio.framed.Store(false)
+	sio.setCapabilities(nil)
+	sio.notifiedDisplayFailures = make(map[int]bool)
+
+	// the writer only ever writes to this connection's transport, even if it outlives it for a moment
+	queue := newCommandQueue(sio.logger)
+	go queue.run(sio.encodeMessage, func(data []byte) error {
+		return writeMessage(transport, data)
+	})
+
+	stop := make(chan bool)
+
+	sio.connectionLock.Lock()
+	sio.transport = transport
+	sio.queue = queue
+	sio.stopChannel = stop
 	sio.connected = true
+	sio.connectionLock.Unlock()
+
+	sio.logger.Infow("Connected to device", "transport", transport)
+	sio.notifyConnectionChanged()
 
 	// Start reading routine
-	go sio.readFromSerial()
+	go sio.readFromSerial(transport, stop)
+
+	sio.requestHandshake()
 
 	return nil
 }
 
-func (sio *SerialIO) readFromSerial() {
+// requestHandshake asks the device to switch to the framed protocol and to describe itself, unless it already
+// has. devices that don't know how will just ignore either request, and we'll keep speaking text with them
+func (sio *SerialIO) requestHandshake() {
+	queue := sio.currentQueue()
+	if queue == nil {
+		return
+	}
+
+	if sio.connectionInfo.Protocol == protocolAuto && !sio.framed.Load() {
+		queue.enqueue(fmt.Sprintf(protocolRequestFormat, protocolVersion))
+	}
+
+	if _, ok := sio.Capabilities(); !ok {
+		queue.enqueue(capabilitiesRequest)
+	}
+}
+
+func (sio *SerialIO) readFromSerial(transport Transport, stop chan bool) {
 	logger := sio.logger.Named("read")
-	reader := bufio.NewReader(sio.conn)
+	reader := transport.Reader()
+
+	// most boards reset when their port is opened, and miss whatever we sent before their sketch started.
+	// a board that's sending is also listening, so we repeat the handshake once we first hear from it
+	heardFromDevice := false
+	repeatHandshake := func() {
+		if !heardFromDevice {
+			heardFromDevice = true
+			sio.requestHandshake()
+		}
+	}
 
+	// every way out of the loop below closes the connection first
 	defer func() {
-		sio.connected = false
 		logger.Debug("Serial connection closed, notifying subscribers")
 
-		// Notify reconnect subscribers
-		for _, notifier := range sio.reconnectNotifiers {
-			notifier <- false
+		sio.notifyConnectionChanged()
+
+		// let the reconnect loop know
+		select {
+		case sio.disconnected <- true:
+		default:
 		}
 	}()
 
 	for {
 		select {
-		case <-sio.stopChannel:
+		case <-stop:
 			logger.Debug("Received stop signal, closing connection")
 			sio.close(logger)
 			return
 		default:
-			line, err := reader.ReadString('\n')
+			isFrame, err := peekFrameStart(reader)
 			if err != nil {
-				logger.Warnw("Failed to read line from serial", "error", err)
+				logger.Warnw("Failed to read from serial", "error", err)
 				sio.close(logger)
 				return
 			}
 
-			sio.handleLine(logger, line)
+			if !isFrame {
+				line, err := readTextLine(reader)
+				if err != nil {
+					logger.Warnw("Failed to read line from serial", "error", err)
+					sio.close(logger)
+					return
+				}
+
+				sio.handleLine(logger, line)
+				repeatHandshake()
+				continue
+			}
+
+			f, err := readFrame(reader)
+			if errors.Is(err, errFrameChecksum) || errors.Is(err, errFrameLength) || errors.Is(err, errFrameVersion) {
+				sio.corruptFrames++
+
+				skipped, skipErr := skipToFrameStart(reader, sio.framed.Load())
+				logger.Debugw("Dropping invalid frame", "error", err, "skippedBytes", skipped, "totalDropped", sio.corruptFrames)
+
+				if skipErr != nil {
+					logger.Warnw("Failed to read from serial", "error", skipErr)
+					sio.close(logger)
+					return
+				}
+
+				continue
+			}
+
+			if err != nil {
+				logger.Warnw("Failed to read frame from serial", "error", err)
+				sio.close(logger)
+				return
+			}
+
+			sio.handleFrame(logger, f)
+			repeatHandshake()
 		}
 	}
 }
 
+// SendToArduino queues a host message (e.g. "<!1|40>") for the device. Queued messages replace any
+// older message of the same kind that hasn't been written yet, and are written in priority order
 func (sio *SerialIO) SendToArduino(message string) error {
-	if !sio.connected || sio.conn == nil {
+	queue := sio.currentQueue()
+	if queue == nil {
 		return errors.New("serial not connected")
 	}
 
-	_, err := sio.conn.Write([]byte(message))
+	queue.enqueue(message)
+
+	return nil
+}
+
+// encodeMessage turns a host message into what's written for it, depending on the protocol the device speaks
+func (sio *SerialIO) encodeMessage(message string) ([]byte, error) {
+	if !sio.framed.Load() {
+		return []byte(message), nil
+	}
+
+	encoded, err := encodeHostMessage(message)
 	if err != nil {
-		sio.logger.Warnw("Failed to write to Arduino", "error", err)
-		return err
+		return nil, fmt.Errorf("encode message for framed protocol: %w", err)
+	}
+
+	return encoded, nil
+}
+
+// writeMessage is the only thing that writes to a transport, and only its connection's queue calls it
+func writeMessage(transport Transport, data []byte) error {
+	if err := transport.Write(data); err != nil {
+		return fmt.Errorf("write to device: %w", err)
 	}
 
 	return nil
 }
 
-// notifyReconnected signals that a reconnection was successful
+// notifyReconnected tells reconnect subscribers that a lost connection was re-established
 func (sio *SerialIO) notifyReconnected() {
-	// Only notify if this wasn't the first connection
-	if sio.retryCount > 0 {
-		sio.logger.Info("Serial connection re-established successfully")
+	sio.logger.Infow("Serial connection re-established successfully", "failedAttempts", sio.retryCount)
+	sio.notifyReconnectSubscribers(true)
+}
 
-		// Notify subscribers about reconnection
-		for _, ch := range sio.reconnectNotifiers {
-			select {
-			case ch <- true:
-				// Successfully sent notification
-			default:
-				// Channel buffer full, skip notification
-			}
+// notifyReconnectFailed tells the user and reconnect subscribers that we're having trouble reconnecting.
+// deej keeps trying regardless, so this only happens once per lost connection
+func (sio *SerialIO) notifyReconnectFailed() {
+	sio.logger.Warnw("Failed to reconnect, will keep trying in the background",
+		"attempts", sio.retryCount,
+		"retryInterval", reconnectMaxDelay)
+
+	sio.deej.notifier.Notify("Can't reconnect to your device!",
+		fmt.Sprintf("Your %s device has been disconnected for a while. Check that it's plugged in.", sio.deviceName))
+
+	sio.notifyReconnectSubscribers(false)
+}
+
+func (sio *SerialIO) notifyReconnectSubscribers(success bool) {
+	for _, ch := range sio.reconnectNotifiers {
+		select {
+		case ch <- success:
+		default:
+		}
+	}
+}
+
+// DeviceName returns the name of the configured device this instance talks to
+func (sio *SerialIO) DeviceName() string {
+	return sio.deviceName
+}
+
+// ConnectionName returns a human-readable description of the current connection (e.g. which port
+// was picked when com_port is "auto"), or an empty string if there isn't one
+func (sio *SerialIO) ConnectionName() string {
+	sio.connectionLock.Lock()
+	defer sio.connectionLock.Unlock()
+
+	if !sio.connected || sio.transport == nil {
+		return ""
+	}
+
+	return sio.transport.String()
+}
+
+// SubscribeToConnectionChanges returns a buffered channel that receives the new ConnectionName
+// whenever a connection is established or lost
+func (sio *SerialIO) SubscribeToConnectionChanges() chan string {
+	ch := make(chan string, 1)
+	sio.connectionConsumers = append(sio.connectionConsumers, ch)
+	return ch
+}
+
+func (sio *SerialIO) notifyConnectionChanged() {
+	name := sio.ConnectionName()
+
+	for _, ch := range sio.connectionConsumers {
+		select {
+		case ch <- name:
+		default:
 		}
 	}
 }
 
-// SubscribeToReconnectEvents returns a buffered channel that receives
-// a notification when serial connection is re-established
+// SubscribeToReconnectEvents returns a buffered channel that receives true whenever a lost serial connection
+// is re-established, and false once repeated attempts to re-establish it have failed
 func (sio *SerialIO) SubscribeToReconnectEvents() chan bool {
 	ch := make(chan bool, 1) // Buffer of 1 to prevent blocking
 	sio.reconnectNotifiers = append(sio.reconnectNotifiers, ch)
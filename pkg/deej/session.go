@@ -18,6 +18,19 @@ type Session interface {
 	Release()
 }
 
+// balancedSession is implemented by sessions whose left/right balance can be adjusted (on Linux).
+// balance goes from -1 (left only) to 1 (right only), and doesn't change the session's level
+type balancedSession interface {
+	GetBalance() float32
+	SetBalance(balance float32) error
+}
+
+// routableSession is implemented by app sessions that can be sent to another output device (on Linux),
+// given its name or description
+type routableSession interface {
+	moveToSink(sink string) error
+}
+
 const (
 
 	// ideally these would share a common ground in baseSession
@@ -38,6 +51,9 @@ type baseSession struct {
 
 	// used by String(), needs to be set by child
 	humanReadableDesc string
+
+	// used by property targets, set by children that have more to go by than a name (lowercase keys)
+	properties map[string]string
 }
 
 func (s *baseSession) Key() string {
@@ -51,3 +67,15 @@ func (s *baseSession) Key() string {
 
 	return strings.ToLower(s.name)
 }
+
+// isDevice tells whether the session controls an entire audio device (master, mic or a specific device),
+// rather than an application
+func (s *baseSession) isDevice() bool {
+	return s.master
+}
+
+// property returns one of the session's properties, e.g. its PulseAudio stream's "media.role"
+func (s *baseSession) property(name string) (string, bool) {
+	value, ok := s.properties[strings.ToLower(name)]
+	return value, ok
+}
@@ -6,3 +6,62 @@ type SessionFinder interface {
 
 	Release() error
 }
+
+// sessionWatcher is implemented by session finders that report sessions coming and going as it happens.
+// the session map then only needs to rescan everything to recover from errors
+type sessionWatcher interface {
+
+	// the channel is closed once the finder stops reporting, after which the session map goes back to polling
+	subscribeToSessionEvents() chan sessionEvent
+}
+
+// deviceChangeNotifier is implemented by session finders that can tell when the default output or input device's
+// volume or mute state changes, which saves master and mic feedback from having to poll for it
+type deviceChangeNotifier interface {
+
+	// the channel holds at most one pending notification, so a burst of changes only wakes the subscriber up once.
+	// it's closed once the finder stops reporting, after which master volume feedback goes back to polling
+	subscribeToDeviceChanges() chan struct{}
+}
+
+type sessionEvent struct {
+	added   []Session
+	removed []Session // the same instances the finder handed out before
+
+	// the finder lost track of what's going on, and only a full rescan will do
+	resync bool
+}
+
+// sendSessionEvent queues a session event without waiting for the session map. if the queue is full, everything
+// in it is replaced by a single resync, since a full rescan makes up for all of it
+func sendSessionEvent(events chan sessionEvent, event sessionEvent) {
+	select {
+	case events <- event:
+		return
+	default:
+	}
+
+	for drained := false; !drained; {
+		select {
+		case <-events:
+		default:
+			drained = true
+		}
+	}
+
+	select {
+	case events <- sessionEvent{resync: true}:
+	default:
+	}
+}
+
+// defaultDeviceSwitcher is implemented by session finders that can change which devices are the default ones.
+// devices go by their name or their description, whichever the user knows them by
+type defaultDeviceSwitcher interface {
+
+	// returns every name the default output (or input) device goes by
+	getDefaultDevice(isOutput bool) ([]string, error)
+
+	// also moves the streams playing on (or recording from) the previous default device over to the new one
+	setDefaultDevice(name string, isOutput bool) error
+}
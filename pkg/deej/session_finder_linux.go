@@ -3,8 +3,14 @@ package deej
 import (
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/jfreymuth/pulse/proto"
+	"github.com/mitchellh/go-ps"
 	"go.uber.org/zap"
 )
 
@@ -14,9 +20,79 @@ type paSessionFinder struct {
 
 	client *proto.Client
 	conn   net.Conn
+
+	// the sessions we last handed out, so that server events can be turned into session events.
+	// sink inputs, sinks and sources are keyed by their index. each sink and source gets a session
+	// for its description and another for its name
+	lock         sync.Mutex
+	sinkInputs   map[uint32]Session
+	sinks        map[uint32][]Session
+	sources      map[uint32][]Session
+	masterSink   *masterSession
+	masterSource *masterSession
+
+	// every session of a sink or source (its master or mic session included) shares one paChannels,
+	// so that they agree on its balance
+	channels     map[paDeviceKey]*paChannels
+	channelsLock sync.Mutex
+
+	serverEvents  chan *proto.SubscribeEvent
+	sessionEvents chan sessionEvent
+	deviceChanges chan struct{}
+}
+
+type paDeviceKey struct {
+	isOutput bool
+	index    uint32
 }
 
-func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
+// PulseAudio subscription masks and event bits (see pulse/def.h)
+const (
+	paSubscriptionMaskSink      = 0x0001
+	paSubscriptionMaskSource    = 0x0002
+	paSubscriptionMaskSinkInput = 0x0004
+	paSubscriptionMaskServer    = 0x0080
+
+	paEventFacilityMask = 0x000F
+	paEventSink         = 0x0000
+	paEventSource       = 0x0001
+	paEventSinkInput    = 0x0002
+	paEventServer       = 0x0007
+
+	paEventTypeMask = 0x0030
+	paEventNew      = 0x0000
+	paEventChange   = 0x0010
+	paEventRemove   = 0x0020
+
+	// server events are queued between the connection's read loop and our own goroutine. if we somehow
+	// fall this far behind, we'll drop them and ask for a full rescan instead
+	paServerEventBacklog = 64
+
+	// prefix for device sessions in logger
+	deviceSessionFormat = "device.%s"
+
+	// not a real PulseAudio property: we look it up ourselves, so that streams can be matched by the process
+	// that spawned them (like a launcher or a wine server)
+	paPropertyProcessParent = "application.process.parent"
+)
+
+// the properties a sink input's session goes by when it has no process name, in order of preference
+var paSessionNameFallbackProperties = []string{"application.name", "application.id", "media.name"}
+
+func newSessionFinder(logger *zap.SugaredLogger, config *CanonicalConfig) (SessionFinder, error) {
+	if config.AudioBackend == audioBackendPipeWire {
+		sf, err := newPWSessionFinder(logger)
+		if err == nil {
+			return sf, nil
+		}
+
+		logger.Warnw("Failed to set up PipeWire session finder, falling back to PulseAudio", "error", err)
+	}
+
+	return newPASessionFinder(logger)
+}
+
+func newPASessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
 	client, conn, err := proto.Connect("")
 	if err != nil {
 		logger.Warnw("Failed to establish PulseAudio connection", "error", err)
@@ -39,6 +115,20 @@ func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
 		sessionLogger: logger.Named("sessions"),
 		client:        client,
 		conn:          conn,
+		sinkInputs:    make(map[uint32]Session),
+		sinks:         make(map[uint32][]Session),
+		sources:       make(map[uint32][]Session),
+		channels:      make(map[paDeviceKey]*paChannels),
+		serverEvents:  make(chan *proto.SubscribeEvent, paServerEventBacklog),
+		sessionEvents: make(chan sessionEvent, paServerEventBacklog),
+		deviceChanges: make(chan struct{}, 1),
+	}
+
+	// subscription failures aren't fatal, the session map will just have to keep polling for sessions
+	if err := sf.subscribe(); err != nil {
+		sf.logger.Warnw("Failed to subscribe to PulseAudio events, sessions will only be found by polling", "error", err)
+		close(sf.sessionEvents)
+		close(sf.deviceChanges)
 	}
 
 	sf.logger.Debug("Created PA session finder instance")
@@ -46,12 +136,262 @@ func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
 	return sf, nil
 }
 
+func (sf *paSessionFinder) subscribe() error {
+
+	// this gets called from the connection's read loop, which also delivers replies to our requests,
+	// so it mustn't make any requests itself (or block for any other reason)
+	sf.client.Callback = func(message interface{}) {
+		switch message := message.(type) {
+		case *proto.SubscribeEvent:
+			select {
+			case sf.serverEvents <- message:
+			default:
+				sendSessionEvent(sf.sessionEvents, sessionEvent{resync: true})
+			}
+
+		case *proto.ConnectionClosed:
+			close(sf.serverEvents)
+		}
+	}
+
+	request := proto.Subscribe{
+		Mask: paSubscriptionMaskSink | paSubscriptionMaskSource | paSubscriptionMaskSinkInput | paSubscriptionMaskServer,
+	}
+
+	if err := sf.client.Request(&request, nil); err != nil {
+		sf.client.Callback = nil
+		return fmt.Errorf("subscribe to PulseAudio events: %w", err)
+	}
+
+	go sf.handleServerEvents()
+
+	return nil
+}
+
+func (sf *paSessionFinder) subscribeToSessionEvents() chan sessionEvent {
+	return sf.sessionEvents
+}
+
+func (sf *paSessionFinder) subscribeToDeviceChanges() chan struct{} {
+	return sf.deviceChanges
+}
+
+// notifyDeviceChange lets the subscriber know that the default sink or source changed, unless it already knows
+func (sf *paSessionFinder) notifyDeviceChange() {
+	select {
+	case sf.deviceChanges <- struct{}{}:
+	default:
+	}
+}
+
+func (sf *paSessionFinder) handleServerEvents() {
+	defer close(sf.sessionEvents)
+	defer close(sf.deviceChanges)
+
+	for event := range sf.serverEvents {
+		facility := event.Event & paEventFacilityMask
+		eventType := event.Event & paEventTypeMask
+
+		switch facility {
+		case paEventSinkInput:
+			switch eventType {
+			case paEventNew:
+				sf.addSinkInput(event.Index)
+			case paEventRemove:
+				sf.removeSinkInput(event.Index)
+			}
+
+		// the default sink or source could've changed (or disappeared), which makes master/mic a different device
+		case paEventSink, paEventSource, paEventServer:
+			switch {
+			case facility != paEventServer && eventType == paEventNew:
+				sf.addDevice(facility == paEventSink, event.Index)
+			case facility != paEventServer && eventType == paEventRemove:
+				sf.removeDevice(facility == paEventSink, event.Index)
+			}
+
+			if eventType != paEventChange || facility == paEventServer {
+				sf.updateMasterSessions()
+			} else if sf.isDefaultDevice(facility == paEventSink, event.Index) {
+
+				// a volume or mute change, most likely. these come without any details, so it's up to
+				// the subscriber to find out what changed (and whether it cares)
+				sf.notifyDeviceChange()
+			}
+		}
+	}
+
+	sf.logger.Debug("PulseAudio connection closed, no longer following server events")
+}
+
+func (sf *paSessionFinder) addSinkInput(index uint32) {
+	request := proto.GetSinkInputInfo{SinkInputIndex: index}
+	reply := proto.GetSinkInputInfoReply{}
+
+	if err := sf.client.Request(&request, &reply); err != nil {
+		sf.logger.Debugw("Failed to get new sink input's info", "sinkInputIndex", index, "error", err)
+		return
+	}
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	// a full rescan might've picked it up already
+	if _, ok := sf.sinkInputs[index]; ok {
+		return
+	}
+
+	session, ok := sf.sessionFromSinkInput(reply)
+	if !ok {
+		return
+	}
+
+	sf.sinkInputs[index] = session
+	sendSessionEvent(sf.sessionEvents, sessionEvent{added: []Session{session}})
+}
+
+func (sf *paSessionFinder) removeSinkInput(index uint32) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	session, ok := sf.sinkInputs[index]
+	if !ok {
+		return
+	}
+
+	delete(sf.sinkInputs, index)
+	sendSessionEvent(sf.sessionEvents, sessionEvent{removed: []Session{session}})
+}
+
+func (sf *paSessionFinder) addDevice(isOutput bool, index uint32) {
+	var deviceSessions []Session
+
+	if isOutput {
+		request := proto.GetSinkInfo{SinkIndex: index}
+		reply := proto.GetSinkInfoReply{}
+
+		if err := sf.client.Request(&request, &reply); err != nil {
+			sf.logger.Debugw("Failed to get new sink's info", "sinkIndex", index, "error", err)
+			return
+		}
+
+		deviceSessions = sf.sessionsFromSink(reply)
+	} else {
+		request := proto.GetSourceInfo{SourceIndex: index}
+		reply := proto.GetSourceInfoReply{}
+
+		if err := sf.client.Request(&request, &reply); err != nil {
+			sf.logger.Debugw("Failed to get new source's info", "sourceIndex", index, "error", err)
+			return
+		}
+
+		deviceSessions = sf.sessionsFromSource(reply)
+	}
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	devices := sf.devices(isOutput)
+
+	// a full rescan might've picked it up already
+	if _, ok := devices[index]; ok || len(deviceSessions) == 0 {
+		return
+	}
+
+	devices[index] = deviceSessions
+	sendSessionEvent(sf.sessionEvents, sessionEvent{added: deviceSessions})
+}
+
+func (sf *paSessionFinder) removeDevice(isOutput bool, index uint32) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	devices := sf.devices(isOutput)
+
+	deviceSessions, ok := devices[index]
+	if !ok {
+		return
+	}
+
+	delete(devices, index)
+	sendSessionEvent(sf.sessionEvents, sessionEvent{removed: deviceSessions})
+
+	sf.channelsLock.Lock()
+	delete(sf.channels, paDeviceKey{isOutput: isOutput, index: index})
+	sf.channelsLock.Unlock()
+}
+
+// devices returns the sink or source sessions we're tracking. assumes the lock is held
+func (sf *paSessionFinder) devices(isOutput bool) map[uint32][]Session {
+	if isOutput {
+		return sf.sinks
+	}
+
+	return sf.sources
+}
+
+// updateMasterSessions replaces the master and mic sessions if the default sink or source is no longer
+// the one they control
+func (sf *paSessionFinder) updateMasterSessions() {
+	event := sessionEvent{}
+
+	masterSink, sinkErr := sf.getMasterSinkSession()
+	masterSource, sourceErr := sf.getMasterSourceSession()
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	if sinkErr == nil && (sf.masterSink == nil || sf.masterSink.streamIndex != masterSink.streamIndex) {
+		if sf.masterSink != nil {
+			event.removed = append(event.removed, sf.masterSink)
+		}
+
+		sf.masterSink = masterSink
+		event.added = append(event.added, masterSink)
+	}
+
+	if sourceErr == nil && (sf.masterSource == nil || sf.masterSource.streamIndex != masterSource.streamIndex) {
+		if sf.masterSource != nil {
+			event.removed = append(event.removed, sf.masterSource)
+		}
+
+		sf.masterSource = masterSource
+		event.added = append(event.added, masterSource)
+	}
+
+	if len(event.added) > 0 || len(event.removed) > 0 {
+		sf.logger.Debugw("Default device changed", "added", event.added, "removed", event.removed)
+		sendSessionEvent(sf.sessionEvents, event)
+	}
+}
+
+// isDefaultDevice tells whether a sink or source is the one the master or mic session controls
+func (sf *paSessionFinder) isDefaultDevice(isOutput bool, index uint32) bool {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	if isOutput {
+		return sf.masterSink != nil && sf.masterSink.streamIndex == index
+	}
+
+	return sf.masterSource != nil && sf.masterSource.streamIndex == index
+}
+
 func (sf *paSessionFinder) GetAllSessions() ([]Session, error) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
 	sessions := []Session{}
+	sf.sinkInputs = make(map[uint32]Session)
+	sf.sinks = make(map[uint32][]Session)
+	sf.sources = make(map[uint32][]Session)
+	sf.masterSink = nil
+	sf.masterSource = nil
 
 	// get the master sink session
 	masterSink, err := sf.getMasterSinkSession()
 	if err == nil {
+		sf.masterSink = masterSink
 		sessions = append(sessions, masterSink)
 	} else {
 		sf.logger.Warnw("Failed to get master audio sink session", "error", err)
@@ -60,11 +400,18 @@ func (sf *paSessionFinder) GetAllSessions() ([]Session, error) {
 	// get the master source session
 	masterSource, err := sf.getMasterSourceSession()
 	if err == nil {
+		sf.masterSource = masterSource
 		sessions = append(sessions, masterSource)
 	} else {
 		sf.logger.Warnw("Failed to get master audio source session", "error", err)
 	}
 
+	// enumerate sinks and sources, so that specific devices can be mapped by name. like on Windows,
+	// failing to do so only means these sessions are missing
+	if err := sf.enumerateAndAddDeviceSessions(&sessions); err != nil {
+		sf.logger.Warnw("Failed to enumerate device sessions", "error", err)
+	}
+
 	// enumerate sink inputs and add sessions along the way
 	if err := sf.enumerateAndAddSessions(&sessions); err != nil {
 		sf.logger.Warnw("Failed to enumerate audio sessions", "error", err)
@@ -85,7 +432,7 @@ func (sf *paSessionFinder) Release() error {
 	return nil
 }
 
-func (sf *paSessionFinder) getMasterSinkSession() (Session, error) {
+func (sf *paSessionFinder) getMasterSinkSession() (*masterSession, error) {
 	request := proto.GetSinkInfo{
 		SinkIndex: proto.Undefined,
 	}
@@ -97,12 +444,14 @@ func (sf *paSessionFinder) getMasterSinkSession() (Session, error) {
 	}
 
 	// create the master sink session
-	sink := newMasterSession(sf.sessionLogger, sf.client, reply.SinkIndex, reply.Channels, true)
+	sink := newMasterSession(sf.sessionLogger, sf.client, reply.SinkIndex,
+		sf.deviceChannels(true, reply.SinkIndex, reply.ChannelMap, reply.ChannelVolumes), true,
+		masterSessionName, masterSessionName)
 
 	return sink, nil
 }
 
-func (sf *paSessionFinder) getMasterSourceSession() (Session, error) {
+func (sf *paSessionFinder) getMasterSourceSession() (*masterSession, error) {
 	request := proto.GetSourceInfo{
 		SourceIndex: proto.Undefined,
 	}
@@ -114,11 +463,193 @@ func (sf *paSessionFinder) getMasterSourceSession() (Session, error) {
 	}
 
 	// create the master source session
-	source := newMasterSession(sf.sessionLogger, sf.client, reply.SourceIndex, reply.Channels, false)
+	source := newMasterSession(sf.sessionLogger, sf.client, reply.SourceIndex,
+		sf.deviceChannels(false, reply.SourceIndex, reply.ChannelMap, reply.ChannelVolumes), false,
+		inputSessionName, inputSessionName)
 
 	return source, nil
 }
 
+// getDefaultDevice returns the default sink's (or source's) name and description
+func (sf *paSessionFinder) getDefaultDevice(isOutput bool) ([]string, error) {
+	if isOutput {
+		request := proto.GetSinkInfo{SinkIndex: proto.Undefined}
+		reply := proto.GetSinkInfoReply{}
+
+		if err := sf.client.Request(&request, &reply); err != nil {
+			return nil, fmt.Errorf("get default sink info: %w", err)
+		}
+
+		return []string{reply.SinkName, paDeviceDescription(reply.Properties)}, nil
+	}
+
+	request := proto.GetSourceInfo{SourceIndex: proto.Undefined}
+	reply := proto.GetSourceInfoReply{}
+
+	if err := sf.client.Request(&request, &reply); err != nil {
+		return nil, fmt.Errorf("get default source info: %w", err)
+	}
+
+	return []string{reply.SourceName, paDeviceDescription(reply.Properties)}, nil
+}
+
+// setDefaultDevice makes the sink (or source) with the given name or description the default one, like
+// pactl set-default-sink does, and moves the streams that were on the previous default device over to it.
+// the master (or mic) session follows along once the server tells us that the default device changed
+func (sf *paSessionFinder) setDefaultDevice(name string, isOutput bool) error {
+	if isOutput {
+		return sf.setDefaultSink(name)
+	}
+
+	return sf.setDefaultSource(name)
+}
+
+func (sf *paSessionFinder) setDefaultSink(name string) error {
+	sink, err := findPASink(sf.client, name)
+	if err != nil {
+		return err
+	}
+
+	previousRequest := proto.GetSinkInfo{SinkIndex: proto.Undefined}
+	previous := proto.GetSinkInfoReply{}
+
+	if err := sf.client.Request(&previousRequest, &previous); err != nil {
+		return fmt.Errorf("get default sink info: %w", err)
+	}
+
+	if err := sf.client.Request(&proto.SetDefaultSink{SinkName: sink.SinkName}, nil); err != nil {
+		return fmt.Errorf("set default sink: %w", err)
+	}
+
+	inputsRequest := proto.GetSinkInputInfoList{}
+	inputsReply := proto.GetSinkInputInfoListReply{}
+
+	if err := sf.client.Request(&inputsRequest, &inputsReply); err != nil {
+		return fmt.Errorf("get sink input list: %w", err)
+	}
+
+	for _, info := range inputsReply {
+		if info.SinkIndex != previous.SinkIndex || info.SinkIndex == sink.SinkIndex {
+			continue
+		}
+
+		request := proto.MoveSinkInput{
+			SinkInputIndex: info.SinkInputIndex,
+			DeviceIndex:    sink.SinkIndex,
+		}
+
+		// streams can refuse to move (e.g. if they were started with PA_STREAM_DONT_MOVE), which is fine
+		if err := sf.client.Request(&request, nil); err != nil {
+			sf.logger.Debugw("Failed to move sink input", "index", info.SinkInputIndex, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// setDefaultSource does the same as setDefaultSink, but never picks (or moves streams away from) monitor sources
+func (sf *paSessionFinder) setDefaultSource(name string) error {
+	sourcesRequest := proto.GetSourceInfoList{}
+	sourcesReply := proto.GetSourceInfoListReply{}
+
+	if err := sf.client.Request(&sourcesRequest, &sourcesReply); err != nil {
+		return fmt.Errorf("get source list: %w", err)
+	}
+
+	var source *proto.GetSourceInfoReply
+	for _, info := range sourcesReply {
+		if info.MonitorSourceIndex != proto.Undefined {
+			continue
+		}
+
+		if strings.EqualFold(info.SourceName, name) || strings.EqualFold(paDeviceDescription(info.Properties), name) {
+			source = info
+			break
+		}
+	}
+
+	if source == nil {
+		return fmt.Errorf("no source named %q", name)
+	}
+
+	previousRequest := proto.GetSourceInfo{SourceIndex: proto.Undefined}
+	previous := proto.GetSourceInfoReply{}
+
+	if err := sf.client.Request(&previousRequest, &previous); err != nil {
+		return fmt.Errorf("get default source info: %w", err)
+	}
+
+	if err := sf.client.Request(&proto.SetDefaultSource{SourceName: source.SourceName}, nil); err != nil {
+		return fmt.Errorf("set default source: %w", err)
+	}
+
+	if previous.MonitorSourceIndex != proto.Undefined {
+		return nil
+	}
+
+	outputsRequest := proto.GetSourceOutputInfoList{}
+	outputsReply := proto.GetSourceOutputInfoListReply{}
+
+	if err := sf.client.Request(&outputsRequest, &outputsReply); err != nil {
+		return fmt.Errorf("get source output list: %w", err)
+	}
+
+	for _, info := range outputsReply {
+		if info.SourceIndex != previous.SourceIndex || info.SourceIndex == source.SourceIndex {
+			continue
+		}
+
+		// (sic) the reply's index field really is called that
+		request := proto.MoveSourceOutput{
+			SourceOutputIndex: info.SourceOutpuIndex,
+			DeviceIndex:       source.SourceIndex,
+		}
+
+		if err := sf.client.Request(&request, nil); err != nil {
+			sf.logger.Debugw("Failed to move source output", "index", info.SourceOutpuIndex, "error", err)
+		}
+	}
+
+	return nil
+}
+
+func (sf *paSessionFinder) enumerateAndAddDeviceSessions(sessions *[]Session) error {
+	sinkRequest := proto.GetSinkInfoList{}
+	sinkReply := proto.GetSinkInfoListReply{}
+
+	if err := sf.client.Request(&sinkRequest, &sinkReply); err != nil {
+		sf.logger.Warnw("Failed to get sink list", "error", err)
+		return fmt.Errorf("get sink list: %w", err)
+	}
+
+	for _, info := range sinkReply {
+		deviceSessions := sf.sessionsFromSink(*info)
+
+		sf.sinks[info.SinkIndex] = deviceSessions
+		*sessions = append(*sessions, deviceSessions...)
+	}
+
+	sourceRequest := proto.GetSourceInfoList{}
+	sourceReply := proto.GetSourceInfoListReply{}
+
+	if err := sf.client.Request(&sourceRequest, &sourceReply); err != nil {
+		sf.logger.Warnw("Failed to get source list", "error", err)
+		return fmt.Errorf("get source list: %w", err)
+	}
+
+	for _, info := range sourceReply {
+		deviceSessions := sf.sessionsFromSource(*info)
+		if len(deviceSessions) == 0 {
+			continue
+		}
+
+		sf.sources[info.SourceIndex] = deviceSessions
+		*sessions = append(*sessions, deviceSessions...)
+	}
+
+	return nil
+}
+
 func (sf *paSessionFinder) enumerateAndAddSessions(sessions *[]Session) error {
 	request := proto.GetSinkInputInfoList{}
 	reply := proto.GetSinkInputInfoListReply{}
@@ -129,22 +660,198 @@ func (sf *paSessionFinder) enumerateAndAddSessions(sessions *[]Session) error {
 	}
 
 	for _, info := range reply {
-		name, ok := info.Properties["application.process.binary"]
-
+		newSession, ok := sf.sessionFromSinkInput(*info)
 		if !ok {
-			sf.logger.Warnw("Failed to get sink input's process name",
-				"sinkInputIndex", info.SinkInputIndex)
-
 			continue
 		}
 
-		// create the deej session object
-		newSession := newPASession(sf.sessionLogger, sf.client, info.SinkInputIndex, info.Channels, name.String())
+		sf.sinkInputs[info.SinkInputIndex] = newSession
 
 		// add it to our slice
 		*sessions = append(*sessions, newSession)
-
 	}
 
 	return nil
 }
+
+// sessionFromSinkInput creates the deej session object for a sink input, named after its process. sink inputs
+// without a process name (flatpak apps, some browsers and games) are named after another property instead,
+// and only skipped if they have none of those either
+func (sf *paSessionFinder) sessionFromSinkInput(info proto.GetSinkInputInfoReply) (Session, bool) {
+	properties := sinkInputProperties(info)
+	channels := newPAChannels(info.ChannelMap, info.ChannelVolumes)
+
+	if isSystemSoundSinkInput(info) {
+		return newPASystemSession(sf.sessionLogger, sf.client, info.SinkInputIndex, channels, properties), true
+	}
+
+	name, ok := properties["application.process.binary"]
+
+	for _, fallback := range paSessionNameFallbackProperties {
+		if ok && name != "" {
+			break
+		}
+
+		name, ok = properties[fallback]
+	}
+
+	if !ok || name == "" {
+		sf.logger.Warnw("Failed to get sink input's process name",
+			"sinkInputIndex", info.SinkInputIndex)
+
+		return nil, false
+	}
+
+	return newPASession(sf.sessionLogger, sf.client, info.SinkInputIndex, channels, name, properties), true
+}
+
+// sinkInputProperties collects a sink input's string properties for property targets to match against
+func sinkInputProperties(info proto.GetSinkInputInfoReply) map[string]string {
+	properties := map[string]string{}
+
+	// string properties are null-terminated, anything else is binary data we've no use for
+	for key, value := range info.Properties {
+		if len(value) > 0 && value[len(value)-1] == 0 {
+			properties[strings.ToLower(key)] = value.String()
+		}
+	}
+
+	if pid, err := strconv.Atoi(properties["application.process.id"]); err == nil {
+		if parent, ok := parentProcessName(pid); ok {
+			properties[paPropertyProcessParent] = parent
+		}
+	}
+
+	return properties
+}
+
+// parentProcessName prefers the name of the parent's executable, which is what PulseAudio would go by
+// (the name in /proc/<pid>/stat is cut short at 15 characters)
+func parentProcessName(pid int) (string, bool) {
+	process, err := ps.FindProcess(pid)
+	if err != nil || process == nil {
+		return "", false
+	}
+
+	parent, err := ps.FindProcess(process.PPid())
+	if err != nil || parent == nil {
+		return "", false
+	}
+
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", parent.Pid())); err == nil {
+		return filepath.Base(exe), true
+	}
+
+	return parent.Executable(), true
+}
+
+func (sf *paSessionFinder) sessionsFromSink(info proto.GetSinkInfoReply) []Session {
+	return sf.deviceSessions(info.SinkIndex, info.ChannelMap, info.ChannelVolumes, true, info.SinkName, info.Properties)
+}
+
+// sessionsFromSource skips monitor sources, which only mirror a sink's output and would otherwise
+// show up next to every sink
+func (sf *paSessionFinder) sessionsFromSource(info proto.GetSourceInfoReply) []Session {
+	if info.MonitorSourceIndex != proto.Undefined {
+		return nil
+	}
+
+	return sf.deviceSessions(info.SourceIndex, info.ChannelMap, info.ChannelVolumes, false, info.SourceName, info.Properties)
+}
+
+// deviceSessions creates the sessions for a single sink or source: one keyed by its description
+// (e.g. "Built-in Audio Analog Stereo"), and one keyed by its name (e.g. "alsa_output.pci-0000_00_1f.3.analog-stereo")
+func (sf *paSessionFinder) deviceSessions(
+	index uint32,
+	channelMap proto.ChannelMap,
+	channelVolumes proto.ChannelVolumes,
+	isOutput bool,
+	name string,
+	properties proto.PropList,
+) []Session {
+
+	keys := []string{name}
+
+	if description := paDeviceDescription(properties); description != "" && description != name {
+		keys = append([]string{description}, keys...)
+	}
+
+	// both sessions control the same device, so they share its balance
+	channels := sf.deviceChannels(isOutput, index, channelMap, channelVolumes)
+
+	sessions := []Session{}
+	for _, key := range keys {
+		sessions = append(sessions, newMasterSession(sf.sessionLogger, sf.client, index, channels, isOutput,
+			key, fmt.Sprintf(deviceSessionFormat, name)))
+	}
+
+	return sessions
+}
+
+// deviceChannels returns the channels shared by a sink's or source's sessions, up to date with the given volumes
+func (sf *paSessionFinder) deviceChannels(
+	isOutput bool,
+	index uint32,
+	channelMap proto.ChannelMap,
+	channelVolumes proto.ChannelVolumes,
+) *paChannels {
+
+	sf.channelsLock.Lock()
+	defer sf.channelsLock.Unlock()
+
+	key := paDeviceKey{isOutput: isOutput, index: index}
+
+	channels, ok := sf.channels[key]
+	if !ok {
+		channels = newPAChannels(channelMap, channelVolumes)
+		sf.channels[key] = channels
+	} else {
+		channels.update(channelMap, channelVolumes)
+	}
+
+	return channels
+}
+
+// findPASink looks a sink up by its name or description
+func findPASink(client *proto.Client, name string) (*proto.GetSinkInfoReply, error) {
+	request := proto.GetSinkInfoList{}
+	reply := proto.GetSinkInfoListReply{}
+
+	if err := client.Request(&request, &reply); err != nil {
+		return nil, fmt.Errorf("get sink list: %w", err)
+	}
+
+	for _, info := range reply {
+		if strings.EqualFold(info.SinkName, name) || strings.EqualFold(paDeviceDescription(info.Properties), name) {
+			return info, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no sink named %q", name)
+}
+
+// paDeviceDescription returns a sink's or source's human-readable name, if it has one
+func paDeviceDescription(properties proto.PropList) string {
+	if description, ok := properties["device.description"]; ok {
+		return description.String()
+	}
+
+	return ""
+}
+
+// isSystemSoundSinkInput tells whether a sink input is a bell, notification or other event sound. these either
+// say so through their media role (like everything that goes through libcanberra), or are played from the
+// server's sample cache, in which case no client or module owns them.
+// event sounds are short-lived, but that's alright: module-stream-restore remembers the volume we set on one
+// and applies it to the ones that follow
+func isSystemSoundSinkInput(info proto.GetSinkInputInfoReply) bool {
+	if role, ok := info.Properties["media.role"]; ok && role.String() == "event" {
+		return true
+	}
+
+	if _, ok := info.Properties["event.id"]; ok {
+		return true
+	}
+
+	return info.ClientIndex == proto.Undefined && info.ModuleIndex == proto.Undefined
+}
@@ -0,0 +1,387 @@
+package deej
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// memSessionFinder stands in for the actual audio server when running with --dry-run. its sessions live in
+// memory and don't control anything: every change deej makes to them is only logged. it starts out with the
+// master, mic and system sessions, along with an app session for every process name in the slider mapping.
+// apps coming and going (and volume changes failing) can be scripted, see readDryRunScript
+type memSessionFinder struct {
+	logger        *zap.SugaredLogger
+	sessionLogger *zap.SugaredLogger
+
+	lock     sync.Mutex
+	sessions map[string]*memSession
+
+	sessionEvents chan sessionEvent
+	deviceChanges chan struct{}
+	stopChannel   chan bool
+}
+
+type memSession struct {
+	baseSession
+
+	finder *memSessionFinder
+
+	lock   sync.Mutex
+	volume float32
+	mute   bool
+
+	// set by a script, to see how deej copes with a session that stopped responding
+	failing bool
+}
+
+// a dry run script holds one action per line, each after the time since deej started (in seconds):
+//
+//	# discord starts, then stops responding, and finally quits
+//	+1.5 add discord.exe 0.8
+//	+4 fail discord.exe
+//	+6 recover discord.exe
+//	+8 remove discord.exe
+const (
+	dryRunActionAdd     = "add"     // add <name> [volume]: an app starts playing
+	dryRunActionRemove  = "remove"  // remove <name>: an app quits
+	dryRunActionFail    = "fail"    // fail <name>: volume and mute changes to a session start failing
+	dryRunActionRecover = "recover" // recover <name>: ...and stop failing again
+
+	dryRunDefaultVolume = 1
+)
+
+var errDryRunSessionFailing = errors.New("dry run: session is set to fail")
+
+// DryRunOptions describe a run that doesn't touch any actual audio sessions
+type DryRunOptions struct {
+
+	// optional, see memSessionFinder
+	ScriptPath string
+}
+
+type dryRunAction struct {
+	offset time.Duration
+	action string
+	name   string
+	volume float32
+}
+
+func newMemSessionFinder(logger *zap.SugaredLogger, config *CanonicalConfig, options DryRunOptions) (*memSessionFinder, error) {
+	actions := []dryRunAction{}
+
+	if options.ScriptPath != "" {
+		var err error
+		if actions, err = readDryRunScript(options.ScriptPath); err != nil {
+			return nil, fmt.Errorf("read dry run script: %w", err)
+		}
+	}
+
+	sf := &memSessionFinder{
+		logger:        logger.Named("session_finder"),
+		sessionLogger: logger.Named("sessions"),
+		sessions:      make(map[string]*memSession),
+		sessionEvents: make(chan sessionEvent),
+		deviceChanges: make(chan struct{}, 1),
+		stopChannel:   make(chan bool),
+	}
+
+	for _, name := range []string{masterSessionName, inputSessionName, systemSessionName} {
+		sf.add(name, dryRunDefaultVolume)
+	}
+
+	for _, device := range config.Devices {
+		device.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+			for _, target := range targets {
+
+				// special and pattern targets aren't anything's name
+				if strings.HasPrefix(target, specialTargetTransformPrefix) || strings.Contains(target, ":") {
+					continue
+				}
+
+				if _, ok := sf.sessions[strings.ToLower(target)]; !ok {
+					sf.add(target, dryRunDefaultVolume)
+				}
+			}
+		})
+	}
+
+	if len(actions) > 0 {
+		go sf.runScript(actions)
+	}
+
+	sf.logger.Infow("Created in-memory session finder, no actual audio sessions will be touched",
+		"sessions", len(sf.sessions),
+		"scriptedActions", len(actions))
+
+	return sf, nil
+}
+
+func (sf *memSessionFinder) GetAllSessions() ([]Session, error) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	sessions := []Session{}
+	for _, session := range sf.sessions {
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (sf *memSessionFinder) subscribeToSessionEvents() chan sessionEvent {
+	return sf.sessionEvents
+}
+
+func (sf *memSessionFinder) subscribeToDeviceChanges() chan struct{} {
+	return sf.deviceChanges
+}
+
+// notifyDeviceChange lets the subscriber know that the master or mic session changed, unless it already knows
+func (sf *memSessionFinder) notifyDeviceChange() {
+	select {
+	case sf.deviceChanges <- struct{}{}:
+	default:
+	}
+}
+
+func (sf *memSessionFinder) Release() error {
+	close(sf.stopChannel)
+	sf.logger.Debug("Released in-memory session finder instance")
+
+	return nil
+}
+
+// add creates a session, and returns the one it replaced if there was one by the same name
+func (sf *memSessionFinder) add(name string, volume float32) (*memSession, *memSession) {
+	session := newMemSession(sf.sessionLogger, sf, name, volume)
+
+	previous := sf.sessions[session.Key()]
+	sf.sessions[session.Key()] = session
+
+	return session, previous
+}
+
+func (sf *memSessionFinder) runScript(actions []dryRunAction) {
+	started := time.Now()
+
+	for _, action := range actions {
+		select {
+		case <-time.After(time.Until(started.Add(action.offset))):
+		case <-sf.stopChannel:
+			return
+		}
+
+		sf.apply(action)
+	}
+
+	sf.logger.Info("Dry run script finished")
+}
+
+func (sf *memSessionFinder) apply(action dryRunAction) {
+	sf.logger.Infow("Running dry run script action", "action", action.action, "name", action.name)
+
+	sf.lock.Lock()
+
+	event := sessionEvent{}
+	key := strings.ToLower(action.name)
+	session, ok := sf.sessions[key]
+
+	switch action.action {
+	case dryRunActionAdd:
+		added, previous := sf.add(action.name, action.volume)
+		event.added = append(event.added, added)
+
+		if previous != nil {
+			event.removed = append(event.removed, previous)
+		}
+
+	case dryRunActionRemove:
+		if ok {
+			delete(sf.sessions, key)
+			event.removed = append(event.removed, session)
+		}
+
+	case dryRunActionFail, dryRunActionRecover:
+		if ok {
+			session.lock.Lock()
+			session.failing = action.action == dryRunActionFail
+			session.lock.Unlock()
+		}
+	}
+
+	sf.lock.Unlock()
+
+	if !ok && action.action != dryRunActionAdd {
+		sf.logger.Warnw("No session to run dry run script action on", "action", action.action, "name", action.name)
+		return
+	}
+
+	if len(event.added) > 0 || len(event.removed) > 0 {
+		select {
+		case sf.sessionEvents <- event:
+		case <-sf.stopChannel:
+		}
+	}
+}
+
+// readDryRunScript parses a dry run script, returning its actions in the order they're due
+func readDryRunScript(path string) ([]dryRunAction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open dry run script: %w", err)
+	}
+
+	defer file.Close()
+
+	var (
+		actions    = []dryRunAction{}
+		scanner    = bufio.NewScanner(file)
+		lineNumber = 0
+		lastOffset time.Duration
+	)
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("dry run script line %d: expected offset, action and name", lineNumber)
+		}
+
+		offset, err := strconv.ParseFloat(strings.TrimPrefix(fields[0], "+"), 64)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("dry run script line %d: invalid offset %q", lineNumber, fields[0])
+		}
+
+		action := dryRunAction{
+			offset: time.Duration(offset * float64(time.Second)),
+			action: strings.ToLower(fields[1]),
+			name:   fields[2],
+			volume: dryRunDefaultVolume,
+		}
+
+		if action.offset < lastOffset {
+			return nil, fmt.Errorf("dry run script line %d: actions must be in order", lineNumber)
+		}
+
+		lastOffset = action.offset
+
+		switch action.action {
+		case dryRunActionAdd:
+			if len(fields) > 3 {
+				volume, err := strconv.ParseFloat(fields[3], 32)
+				if err != nil || volume < 0 || volume > 1 {
+					return nil, fmt.Errorf("dry run script line %d: invalid volume %q", lineNumber, fields[3])
+				}
+
+				action.volume = float32(volume)
+			}
+
+		case dryRunActionRemove, dryRunActionFail, dryRunActionRecover:
+
+		default:
+			return nil, fmt.Errorf("dry run script line %d: unknown action %q", lineNumber, fields[1])
+		}
+
+		actions = append(actions, action)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read dry run script: %w", err)
+	}
+
+	return actions, nil
+}
+
+func newMemSession(logger *zap.SugaredLogger, finder *memSessionFinder, name string, volume float32) *memSession {
+	s := &memSession{finder: finder, volume: volume}
+
+	// the master and mic sessions stand in for devices, which is what makes them count as mapped
+	switch strings.ToLower(name) {
+	case masterSessionName, inputSessionName:
+		s.master = true
+	case systemSessionName:
+		s.system = true
+	}
+
+	s.name = name
+	s.humanReadableDesc = name
+
+	s.logger = logger.Named(s.Key())
+	s.logger.Debugw(sessionCreationLogMessage, "session", s)
+
+	return s
+}
+
+func (s *memSession) GetVolume() float32 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.volume
+}
+
+func (s *memSession) SetVolume(v float32) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.failing {
+		s.logger.Warnw("Failed to set session volume", "error", errDryRunSessionFailing, "volume", v)
+		return fmt.Errorf("adjust session volume: %w", errDryRunSessionFailing)
+	}
+
+	s.logger.Infow("Would adjust session volume", "from", fmt.Sprintf("%.2f", s.volume), "to", fmt.Sprintf("%.2f", v))
+	s.volume = v
+
+	if s.master {
+		s.finder.notifyDeviceChange()
+	}
+
+	return nil
+}
+
+func (s *memSession) GetMute() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.mute
+}
+
+func (s *memSession) SetMute(m bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.failing {
+		s.logger.Warnw("Failed to set mute", "error", errDryRunSessionFailing)
+		return fmt.Errorf("adjust session mute: %w", errDryRunSessionFailing)
+	}
+
+	s.logger.Infow("Would adjust session mute state", "to", m)
+	s.mute = m
+
+	if s.master {
+		s.finder.notifyDeviceChange()
+	}
+
+	return nil
+}
+
+func (s *memSession) Release() {
+	s.logger.Debug("Releasing audio session")
+}
+
+func (s *memSession) String() string {
+	return fmt.Sprintf(sessionStringFormat, s.humanReadableDesc, s.GetVolume())
+}
@@ -0,0 +1,271 @@
+package deej
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newTestConfig creates a config with just the default device, mapped as given
+func newTestConfig(mapping map[int][]string) *CanonicalConfig {
+	sliderMapping := newSliderMap()
+	for sliderIdx, targets := range mapping {
+		sliderMapping.set(sliderIdx, targets)
+	}
+
+	return &CanonicalConfig{
+		Devices: []*DeviceConfig{{
+			Name:            defaultDeviceName,
+			SliderMapping:   sliderMapping,
+			SliderMaxVolume: make(map[int]int),
+			SliderFilters:   make(map[int]SliderFilterConfig),
+			SliderCurves:    make(map[int]VolumeCurve),
+			SliderRoutes:    make(map[int][]SliderRoute),
+		}},
+	}
+}
+
+// newTestSessionMap creates a session map over an in-memory session finder, which holds the given apps (at the
+// given volumes) on top of its usual sessions
+func newTestSessionMap(t *testing.T, config *CanonicalConfig, apps map[string]float32) (*sessionMap, *memSessionFinder) {
+	t.Helper()
+
+	logger := zap.NewNop().Sugar()
+
+	finder, err := newMemSessionFinder(logger, config, DryRunOptions{})
+	if err != nil {
+		t.Fatalf("create session finder: %v", err)
+	}
+
+	t.Cleanup(func() { finder.Release() })
+
+	for name, volume := range apps {
+		finder.add(name, volume)
+	}
+
+	m, err := newSessionMap(&Deej{logger: logger, config: config}, logger, finder)
+	if err != nil {
+		t.Fatalf("create session map: %v", err)
+	}
+
+	if err := m.getAndAddSessions(); err != nil {
+		t.Fatalf("get sessions: %v", err)
+	}
+
+	return m, finder
+}
+
+func TestReadDryRunScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     []dryRunAction
+		wantErr  bool
+	}{
+		{
+			name: "every action",
+			contents: "# discord starts, then stops responding, and finally quits\n" +
+				"+1.5 add discord.exe 0.8\n" +
+				"\n" +
+				"+4 FAIL discord.exe\n" +
+				"6 recover discord.exe\n" +
+				"+8 remove discord.exe\n" +
+				"+8 add spotify.exe\n",
+			want: []dryRunAction{
+				{offset: 1500 * time.Millisecond, action: dryRunActionAdd, name: "discord.exe", volume: 0.8},
+				{offset: 4 * time.Second, action: dryRunActionFail, name: "discord.exe", volume: dryRunDefaultVolume},
+				{offset: 6 * time.Second, action: dryRunActionRecover, name: "discord.exe", volume: dryRunDefaultVolume},
+				{offset: 8 * time.Second, action: dryRunActionRemove, name: "discord.exe", volume: dryRunDefaultVolume},
+				{offset: 8 * time.Second, action: dryRunActionAdd, name: "spotify.exe", volume: dryRunDefaultVolume},
+			},
+		},
+		{name: "empty", contents: "", want: []dryRunAction{}},
+		{name: "missing name", contents: "+1 add\n", wantErr: true},
+		{name: "negative offset", contents: "-1 add discord.exe\n", wantErr: true},
+		{name: "out of order", contents: "+2 add discord.exe\n+1 remove discord.exe\n", wantErr: true},
+		{name: "volume out of range", contents: "+1 add discord.exe 1.5\n", wantErr: true},
+		{name: "unknown action", contents: "+1 pause discord.exe\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "script.txt")
+			if err := os.WriteFile(path, []byte(tt.contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readDryRunScript(path)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readDryRunScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readDryRunScript() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionMapped(t *testing.T) {
+	config := newTestConfig(map[int][]string{
+		0: {"master"},
+		1: {"Discord.exe"},
+		2: {"glob:*game*"},
+		3: {"deej.unmapped", "deej.current"},
+	})
+	config.IgnoreUnmapped = []string{"steam.exe"}
+
+	m, _ := newTestSessionMap(t, config, nil)
+	logger := zap.NewNop().Sugar()
+
+	headphones := newMemSession(logger, nil, "Headphones", 1)
+	headphones.master = true
+
+	tests := []struct {
+		name    string
+		session Session
+		want    bool
+	}{
+		{"master", newMemSession(logger, nil, masterSessionName, 1), true},
+		{"mic", newMemSession(logger, nil, inputSessionName, 1), true},
+		{"system", newMemSession(logger, nil, systemSessionName, 1), true},
+		{"device", headphones, true},
+		{"ignored", newMemSession(logger, nil, "steam.exe", 1), true},
+		{"mapped by name", newMemSession(logger, nil, "discord.exe", 1), true},
+		{"mapped by pattern", newMemSession(logger, nil, "mygame.exe", 1), true},
+		{"special targets don't count", newMemSession(logger, nil, "spotify.exe", 1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.sessionMapped(tt.session); got != tt.want {
+				t.Errorf("sessionMapped(%v) = %v, want %v", tt.session.Key(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSliderMoveEvent(t *testing.T) {
+	apps := map[string]float32{
+		"discord.exe":   0.5,
+		"mygame.exe":    0.3,
+		"othergame.exe": 0.4,
+		"spotify.exe":   0.8,
+		"chrome.exe":    0.9,
+	}
+
+	tests := []struct {
+		name   string
+		events []SliderMoveEvent
+
+		// sessions that start out failing
+		failing []string
+
+		wantVolumes map[string]float32
+		wantMutes   map[string]bool
+	}{
+		{
+			name:        "slider sets the volume",
+			events:      []SliderMoveEvent{{SliderID: 1, PercentValue: 0.25}},
+			wantVolumes: map[string]float32{"discord.exe": 0.25, "spotify.exe": 0.8},
+		},
+		{
+			name:        "slider max volume",
+			events:      []SliderMoveEvent{{SliderID: 3, PercentValue: 0.5}},
+			wantVolumes: map[string]float32{"spotify.exe": 0.25},
+		},
+		{
+			name:        "pattern target sets every match",
+			events:      []SliderMoveEvent{{SliderID: 2, PercentValue: 0.7}},
+			wantVolumes: map[string]float32{"mygame.exe": 0.7, "othergame.exe": 0.7, "discord.exe": 0.5},
+		},
+		{
+			name:        "unmapped target",
+			events:      []SliderMoveEvent{{SliderID: 4, PercentValue: 0.2}},
+			wantVolumes: map[string]float32{"chrome.exe": 0.2, masterSessionName: 1, "discord.exe": 0.5},
+		},
+		{
+			name:        "master",
+			events:      []SliderMoveEvent{{SliderID: 0, PercentValue: 0.6}},
+			wantVolumes: map[string]float32{masterSessionName: 0.6},
+		},
+		{
+			name:        "encoder steps",
+			events:      []SliderMoveEvent{{SliderID: 1, Command: "+"}, {SliderID: 1, Command: "+"}, {SliderID: 2, Command: "-"}},
+			wantVolumes: map[string]float32{"discord.exe": 0.52, "mygame.exe": 0.29, "othergame.exe": 0.39},
+		},
+		{
+			name:        "encoder leaves a volume above the slider's max alone",
+			events:      []SliderMoveEvent{{SliderID: 3, Command: "+"}},
+			wantVolumes: map[string]float32{"spotify.exe": 0.8},
+		},
+		{
+			name:      "button toggles mute",
+			events:    []SliderMoveEvent{{SliderID: 1, Command: "^"}, {SliderID: 2, Command: "^"}, {SliderID: 2, Command: "^"}},
+			wantMutes: map[string]bool{"discord.exe": true, "mygame.exe": false},
+		},
+		{
+			name:        "unmapped slider",
+			events:      []SliderMoveEvent{{SliderID: 9, PercentValue: 0}},
+			wantVolumes: map[string]float32{"discord.exe": 0.5, "chrome.exe": 0.9, masterSessionName: 1},
+		},
+		{
+			name:        "unknown device",
+			events:      []SliderMoveEvent{{Device: "desk", SliderID: 1, PercentValue: 0}},
+			wantVolumes: map[string]float32{"discord.exe": 0.5},
+		},
+		{
+			name:        "failing session",
+			events:      []SliderMoveEvent{{SliderID: 2, PercentValue: 0.1}},
+			failing:     []string{"mygame.exe"},
+			wantVolumes: map[string]float32{"mygame.exe": 0.3, "othergame.exe": 0.1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig(map[int][]string{
+				0: {"master"},
+				1: {"discord.exe"},
+				2: {"glob:*game*"},
+				3: {"spotify.exe"},
+				4: {"deej.unmapped"},
+			})
+			config.Devices[0].SliderMaxVolume[3] = 50
+
+			m, finder := newTestSessionMap(t, config, apps)
+
+			for _, name := range tt.failing {
+				finder.apply(dryRunAction{action: dryRunActionFail, name: name})
+			}
+
+			for _, event := range tt.events {
+				if event.Device == "" {
+					event.Device = defaultDeviceName
+				}
+
+				// slow enough for encoder steps to be as small as they get
+				m.lastEncoderEvent = time.Now().Add(-time.Second)
+				m.handleSliderMoveEvent(event)
+			}
+
+			for name, want := range tt.wantVolumes {
+				if got := finder.sessions[name].GetVolume(); math.Abs(float64(got-want)) > 1e-4 {
+					t.Errorf("%s volume = %v, want %v", name, got, want)
+				}
+			}
+
+			for name, want := range tt.wantMutes {
+				if got := finder.sessions[name].GetMute(); got != want {
+					t.Errorf("%s mute = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
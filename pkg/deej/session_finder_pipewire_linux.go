@@ -0,0 +1,931 @@
+package deej
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pwSessionFinder works with PipeWire's own objects rather than going through pipewire-pulse. it keeps a live
+// copy of the PipeWire object graph by following pw-dump's monitor output, which means looking sessions up (and
+// reading their volume) never costs a round trip. pw-dump is restarted whenever it stops (e.g. along with
+// PipeWire itself). volume and mute changes are written as commands to a single pw-cli process that stays
+// running alongside it (see pwControl). the rarer changes (switching the default device and moving streams)
+// still run wpctl and pw-metadata
+type pwSessionFinder struct {
+	logger        *zap.SugaredLogger
+	sessionLogger *zap.SugaredLogger
+
+	control *pwControl
+
+	lock    sync.Mutex
+	monitor *exec.Cmd
+	nodes   map[int]*pwNode
+	devices map[int][]pwRoute // active routes by device ID
+
+	// node names of the default sink and source, as announced by the "default" metadata object
+	defaultSink   string
+	defaultSource string
+
+	// the sessions we last handed out, so that changes to the graph can be turned into session events.
+	// nil until GetAllSessions is first called
+	sessions map[pwSessionKey]Session
+
+	// closed once the initial object graph has been read, and once the finder is released
+	ready    chan struct{}
+	released chan struct{}
+
+	sessionEvents chan sessionEvent
+	deviceChanges chan struct{}
+}
+
+// pwSessionKey tells the sessions we hand out apart: by the node they control, and the name they go by
+type pwSessionKey struct {
+	nodeID int
+	name   string
+}
+
+// the subset of a pw-dump object that we care about. removed objects come with a null info
+type pwObject struct {
+	ID   int    `json:"id"`
+	Type string `json:"type"`
+
+	Info *struct {
+		Props  map[string]interface{} `json:"props"`
+		Params struct {
+			Props []pwNodeProps `json:"Props"`
+			Route []pwRoute     `json:"Route"`
+		} `json:"params"`
+	} `json:"info"`
+
+	Metadata []struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	} `json:"metadata"`
+}
+
+type pwNodeProps struct {
+	Mute           *bool     `json:"mute"`
+	ChannelVolumes []float64 `json:"channelVolumes"`
+}
+
+// a device's route is what most sinks and sources actually keep their volume in (it's also what gets restored
+// the next time the device shows up). wpctl and pavucontrol both change the route's volume for such nodes
+type pwRoute struct {
+	Index  int         `json:"index"`
+	Device int         `json:"device"`
+	Props  pwNodeProps `json:"props"`
+}
+
+type pwNode struct {
+	id    int
+	class string
+	props map[string]interface{}
+
+	mute           bool
+	channelVolumes []float64
+
+	// the device and route the node belongs to, or -1 for nodes without one (like app streams)
+	deviceID    int
+	routeDevice int
+}
+
+// pwControl is a pw-cli process that's kept running to write commands to, one per line, so that changing
+// a volume doesn't have to start a process of its own every time. it's restarted if it ever stops.
+// pw-cli doesn't say when it's done with a command, so each one is followed by a marker command that doesn't
+// exist. pw-cli complains about it by name, and everything it printed before that belongs to the actual command
+type pwControl struct {
+	logger *zap.SugaredLogger
+
+	lock     sync.Mutex
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	output   chan string // pw-cli's output lines, closed once it exits
+	commands int
+}
+
+const (
+	pwDumpCommand     = "pw-dump"
+	pwCLICommand      = "pw-cli"
+	pwCtlCommand      = "wpctl"
+	pwMetadataCommand = "pw-metadata"
+	pwReadyTimeout    = 3 * time.Second
+
+	pwTypeNode     = "PipeWire:Interface:Node"
+	pwTypeDevice   = "PipeWire:Interface:Device"
+	pwTypeMetadata = "PipeWire:Interface:Metadata"
+
+	pwClassSink         = "Audio/Sink"
+	pwClassSource       = "Audio/Source"
+	pwClassOutputStream = "Stream/Output/Audio"
+
+	pwMetadataDefaultSink   = "default.audio.sink"
+	pwMetadataDefaultSource = "default.audio.source"
+
+	// session events wait here for the session map. if it somehow falls this far behind, they're
+	// replaced by a full rescan (see sendSessionEvent)
+	pwSessionEventBacklog = 64
+
+	// followed by the command's number (see pwControl)
+	pwCLIMarkerPrefix  = "deej-done-"
+	pwCLIReplyTimeout  = 2 * time.Second
+	pwCLIOutputBacklog = 32
+)
+
+var errPipeWireNotReady = errors.New("pipewire: no object graph received")
+
+func newPWSessionFinder(logger *zap.SugaredLogger) (*pwSessionFinder, error) {
+	for _, command := range []string{pwDumpCommand, pwCLICommand} {
+		if _, err := exec.LookPath(command); err != nil {
+			return nil, fmt.Errorf("find %s: %w", command, err)
+		}
+	}
+
+	sf := &pwSessionFinder{
+		logger:        logger.Named("session_finder"),
+		sessionLogger: logger.Named("sessions"),
+		nodes:         make(map[int]*pwNode),
+		devices:       make(map[int][]pwRoute),
+		ready:         make(chan struct{}),
+		released:      make(chan struct{}),
+		sessionEvents: make(chan sessionEvent, pwSessionEventBacklog),
+		deviceChanges: make(chan struct{}, 1),
+	}
+
+	output, err := sf.startMonitor()
+	if err != nil {
+		return nil, err
+	}
+
+	go sf.follow(output)
+
+	select {
+	case <-sf.ready:
+	case <-time.After(pwReadyTimeout):
+		sf.stopMonitor()
+		return nil, errPipeWireNotReady
+	}
+
+	sf.control = &pwControl{logger: sf.logger.Named("control")}
+	if err := sf.control.start(); err != nil {
+		sf.stopMonitor()
+		return nil, fmt.Errorf("start pw-cli: %w", err)
+	}
+
+	sf.logger.Debug("Created PipeWire session finder instance")
+
+	return sf, nil
+}
+
+// startMonitor starts pw-dump, which prints the whole object graph and then every change to it
+func (sf *pwSessionFinder) startMonitor() (io.Reader, error) {
+	monitor := exec.Command(pwDumpCommand, "--monitor", "--no-colors")
+
+	stdout, err := monitor.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("get pw-dump output: %w", err)
+	}
+
+	if err := monitor.Start(); err != nil {
+		return nil, fmt.Errorf("start pw-dump: %w", err)
+	}
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	// we could've been released while starting it
+	select {
+	case <-sf.released:
+		monitor.Process.Kill()
+	default:
+	}
+
+	sf.monitor = monitor
+
+	return stdout, nil
+}
+
+// stopMonitor stops pw-dump for good, and with it the goroutine that follows it
+func (sf *pwSessionFinder) stopMonitor() error {
+	close(sf.released)
+
+	sf.lock.Lock()
+	monitor := sf.monitor
+	sf.lock.Unlock()
+
+	if monitor == nil {
+		return nil
+	}
+
+	return monitor.Process.Kill()
+}
+
+// follow applies each batch of changed objects pw-dump prints, and restarts pw-dump whenever it stops, with
+// the same backoff as device reconnects, until the finder is released. our copy of the graph is kept (and used)
+// in the meantime
+func (sf *pwSessionFinder) follow(output io.Reader) {
+	defer close(sf.sessionEvents)
+	defer close(sf.deviceChanges)
+
+	failures := 0
+
+	for {
+		if output != nil {
+			batches, err := sf.readMonitor(output)
+
+			sf.lock.Lock()
+			monitor := sf.monitor
+			sf.monitor = nil
+			sf.lock.Unlock()
+
+			monitor.Wait()
+
+			select {
+			case <-sf.released:
+				return
+			default:
+			}
+
+			if batches > 0 {
+				failures = 0
+			} else {
+				failures++
+			}
+
+			sf.logger.Warnw("pw-dump stopped, restarting it", "error", err, "nextAttemptIn", reconnectDelay(failures))
+		}
+
+		select {
+		case <-sf.released:
+			return
+		case <-time.After(reconnectDelay(failures)):
+		}
+
+		var err error
+		if output, err = sf.startMonitor(); err != nil {
+			failures++
+			sf.logger.Warnw("Failed to restart pw-dump", "error", err, "nextAttemptIn", reconnectDelay(failures))
+		}
+	}
+}
+
+// readMonitor applies the batches one pw-dump prints until it stops, and returns how many there were.
+// the first batch is the whole graph, which replaces whatever we had from an earlier pw-dump
+func (sf *pwSessionFinder) readMonitor(output io.Reader) (int, error) {
+	decoder := json.NewDecoder(bufio.NewReader(output))
+
+	for batches := 0; ; batches++ {
+		objects := []pwObject{}
+		if err := decoder.Decode(&objects); err != nil {
+			if errors.Is(err, io.EOF) {
+				return batches, nil
+			}
+
+			return batches, fmt.Errorf("parse PipeWire object dump: %w", err)
+		}
+
+		sf.lock.Lock()
+		if batches == 0 {
+			sf.nodes = make(map[int]*pwNode)
+			sf.devices = make(map[int][]pwRoute)
+		}
+
+		for _, object := range objects {
+			sf.apply(object)
+		}
+
+		sf.updateSessions()
+		sf.lock.Unlock()
+
+		if batches == 0 {
+			select {
+			case <-sf.ready:
+				sf.notifyDeviceChange()
+			default:
+				close(sf.ready)
+			}
+		}
+	}
+}
+
+// apply updates our copy of the graph with a single object. assumes the lock is held
+func (sf *pwSessionFinder) apply(object pwObject) {
+	if object.Type == pwTypeMetadata || len(object.Metadata) > 0 {
+		for _, entry := range object.Metadata {
+			var value struct {
+				Name string `json:"name"`
+			}
+
+			if err := json.Unmarshal(entry.Value, &value); err != nil {
+				continue
+			}
+
+			switch entry.Key {
+			case pwMetadataDefaultSink:
+				sf.defaultSink = value.Name
+				sf.notifyDeviceChange()
+			case pwMetadataDefaultSource:
+				sf.defaultSource = value.Name
+				sf.notifyDeviceChange()
+			}
+		}
+
+		return
+	}
+
+	if object.Info == nil {
+		delete(sf.nodes, object.ID)
+		delete(sf.devices, object.ID)
+		return
+	}
+
+	_, knownDevice := sf.devices[object.ID]
+	if object.Type == pwTypeDevice || (object.Type == "" && knownDevice) {
+		sf.applyDevice(object)
+		return
+	}
+
+	if object.Type != "" && object.Type != pwTypeNode {
+		return
+	}
+
+	node, ok := sf.nodes[object.ID]
+	if !ok {
+		node = &pwNode{id: object.ID, deviceID: -1, routeDevice: -1}
+	}
+
+	// changes only carry what changed, so keep whatever we already know otherwise
+	if object.Info.Props != nil {
+		node.props = object.Info.Props
+		node.class = pwPropString(node.props, "media.class")
+		node.deviceID = pwPropInt(node.props, "device.id")
+		node.routeDevice = pwPropInt(node.props, "card.profile.device")
+	}
+
+	for _, params := range object.Info.Params.Props {
+		if params.Mute != nil {
+			node.mute = *params.Mute
+		}
+
+		if len(params.ChannelVolumes) > 0 {
+			node.channelVolumes = params.ChannelVolumes
+		}
+	}
+
+	if len(object.Info.Params.Props) > 0 && sf.isDefaultNode(node) {
+		sf.notifyDeviceChange()
+	}
+
+	switch node.class {
+	case pwClassSink, pwClassSource, pwClassOutputStream:
+		sf.nodes[object.ID] = node
+	}
+}
+
+// applyDevice keeps track of a device's active routes. assumes the lock is held
+func (sf *pwSessionFinder) applyDevice(object pwObject) {
+	routes, ok := sf.devices[object.ID]
+	if ok && len(object.Info.Params.Route) == 0 {
+		return
+	}
+
+	routes = object.Info.Params.Route
+	sf.devices[object.ID] = routes
+
+	for _, node := range sf.nodes {
+		if node.deviceID == object.ID && sf.isDefaultNode(node) {
+			sf.notifyDeviceChange()
+		}
+	}
+}
+
+// route returns the route a node keeps its volume in. assumes the lock is held
+func (sf *pwSessionFinder) route(node *pwNode) (pwRoute, bool) {
+	if node.deviceID < 0 || node.routeDevice < 0 {
+		return pwRoute{}, false
+	}
+
+	for _, route := range sf.devices[node.deviceID] {
+		if route.Device == node.routeDevice {
+			return route, true
+		}
+	}
+
+	return pwRoute{}, false
+}
+
+// levels returns a node's linear channel volumes and mute state, from its route if it has one
+func (sf *pwSessionFinder) levels(id int) ([]float64, bool, bool) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	node, ok := sf.nodes[id]
+	if !ok {
+		return nil, false, false
+	}
+
+	volumes, mute := node.channelVolumes, node.mute
+
+	if route, ok := sf.route(node); ok {
+		if len(route.Props.ChannelVolumes) > 0 {
+			volumes = route.Props.ChannelVolumes
+		}
+
+		if route.Props.Mute != nil {
+			mute = *route.Props.Mute
+		}
+	}
+
+	return volumes, mute, true
+}
+
+// setVolume sets all of a node's channels to the given volume, which is on the same (cubic) scale as wpctl's
+func (sf *pwSessionFinder) setVolume(id int, v float32) error {
+	volumes, _, ok := sf.levels(id)
+	if !ok {
+		return fmt.Errorf("no node %d", id)
+	}
+
+	if len(volumes) == 0 {
+		return fmt.Errorf("node %d has no known channels", id)
+	}
+
+	linear := strconv.FormatFloat(math.Pow(float64(v), 3), 'f', 6, 64)
+
+	channels := make([]string, len(volumes))
+	for idx := range channels {
+		channels[idx] = linear
+	}
+
+	return sf.setProps(id, fmt.Sprintf(`"channelVolumes": [ %s ]`, strings.Join(channels, ", ")))
+}
+
+func (sf *pwSessionFinder) setMute(id int, m bool) error {
+	return sf.setProps(id, fmt.Sprintf(`"mute": %t`, m))
+}
+
+// setProps changes the given props the way wpctl does: on the node's route if it has one, and on the node otherwise
+func (sf *pwSessionFinder) setProps(id int, props string) error {
+	sf.lock.Lock()
+
+	node, ok := sf.nodes[id]
+	if !ok {
+		sf.lock.Unlock()
+		return fmt.Errorf("no node %d", id)
+	}
+
+	command := fmt.Sprintf("set-param %d Props { %s }", id, props)
+	if route, ok := sf.route(node); ok {
+		command = fmt.Sprintf(`set-param %d Route { "index": %d, "device": %d, "props": { %s }, "save": true }`,
+			node.deviceID, route.Index, route.Device, props)
+	}
+
+	sf.lock.Unlock()
+
+	return sf.control.run(command)
+}
+
+func (sf *pwSessionFinder) subscribeToSessionEvents() chan sessionEvent {
+	return sf.sessionEvents
+}
+
+func (sf *pwSessionFinder) subscribeToDeviceChanges() chan struct{} {
+	return sf.deviceChanges
+}
+
+// updateSessions compares the sessions the graph calls for with the ones we last handed out, and reports
+// the difference. assumes the lock is held
+func (sf *pwSessionFinder) updateSessions() {
+	if sf.sessions == nil {
+		return
+	}
+
+	current := sf.currentSessions(sf.sessions)
+	event := sessionEvent{}
+
+	for key, session := range sf.sessions {
+		if _, ok := current[key]; !ok {
+			event.removed = append(event.removed, session)
+		}
+	}
+
+	for key, session := range current {
+		if _, ok := sf.sessions[key]; !ok {
+			event.added = append(event.added, session)
+		}
+	}
+
+	sf.sessions = current
+
+	if len(event.added) > 0 || len(event.removed) > 0 {
+		sendSessionEvent(sf.sessionEvents, event)
+	}
+}
+
+// notifyDeviceChange lets the subscriber know that the default sink or source changed, unless it already knows
+func (sf *pwSessionFinder) notifyDeviceChange() {
+	select {
+	case sf.deviceChanges <- struct{}{}:
+	default:
+	}
+}
+
+// isDefaultNode tells whether a node is the default sink or source. assumes the lock is held
+func (sf *pwSessionFinder) isDefaultNode(node *pwNode) bool {
+	name := pwPropString(node.props, "node.name")
+
+	switch node.class {
+	case pwClassSink:
+		return name == sf.defaultSink
+	case pwClassSource:
+		return name == sf.defaultSource
+	}
+
+	return false
+}
+
+func (sf *pwSessionFinder) GetAllSessions() ([]Session, error) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	sf.sessions = sf.currentSessions(nil)
+
+	sessions := []Session{}
+	for _, session := range sf.sessions {
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// currentSessions creates the sessions the graph calls for, reusing the known ones that are still the same.
+// with no known sessions at all, it's a full rescan. assumes the lock is held
+func (sf *pwSessionFinder) currentSessions(known map[pwSessionKey]Session) map[pwSessionKey]Session {
+	sessions := map[pwSessionKey]Session{}
+
+	add := func(node *pwNode, name string, master bool, properties map[string]string) {
+		key := pwSessionKey{nodeID: node.id, name: name}
+
+		if session, ok := known[key]; ok {
+			sessions[key] = session
+			return
+		}
+
+		if !master {
+			if pid, err := strconv.Atoi(properties["application.process.id"]); err == nil {
+				if parent, ok := parentProcessName(pid); ok {
+					properties[paPropertyProcessParent] = parent
+				}
+			}
+		}
+
+		sessions[key] = newPWSession(sf.sessionLogger, sf, node.id, name, master, properties)
+	}
+
+	for _, node := range sf.nodes {
+		switch node.class {
+		case pwClassSink, pwClassSource:
+			defaultNode := sf.defaultSource
+			masterName := inputSessionName
+
+			if node.class == pwClassSink {
+				defaultNode = sf.defaultSink
+				masterName = masterSessionName
+			}
+
+			if pwPropString(node.props, "node.name") == defaultNode {
+				add(node, masterName, true, nil)
+			}
+
+			for _, name := range pwDeviceSessionNames(node) {
+				add(node, name, true, nil)
+			}
+
+		case pwClassOutputStream:
+			properties := map[string]string{}
+			for key := range node.props {
+				properties[strings.ToLower(key)] = pwPropString(node.props, key)
+			}
+
+			// streams without a process name go by another property instead, like they do with PulseAudio
+			name := properties["application.process.binary"]
+			for _, fallback := range paSessionNameFallbackProperties {
+				if name != "" {
+					break
+				}
+
+				name = properties[fallback]
+			}
+
+			if name == "" {
+				if known == nil {
+					sf.logger.Warnw("Failed to get stream node's process name", "nodeID", node.id)
+				}
+
+				continue
+			}
+
+			add(node, name, false, properties)
+		}
+	}
+
+	return sessions
+}
+
+func (sf *pwSessionFinder) Release() error {
+	sf.control.stop()
+
+	if err := sf.stopMonitor(); err != nil {
+		sf.logger.Warnw("Failed to stop pw-dump", "error", err)
+		return fmt.Errorf("stop pw-dump: %w", err)
+	}
+
+	sf.logger.Debug("Released PipeWire session finder instance")
+
+	return nil
+}
+
+// getDefaultDevice returns the default sink's (or source's) node name and description
+func (sf *pwSessionFinder) getDefaultDevice(isOutput bool) ([]string, error) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	name := sf.defaultSource
+	if isOutput {
+		name = sf.defaultSink
+	}
+
+	for _, node := range sf.nodes {
+		if pwPropString(node.props, "node.name") == name {
+			return []string{name, pwPropString(node.props, "node.description")}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no default device node %q", name)
+}
+
+// setDefaultDevice makes the sink (or source) node with the given name or description the default one.
+// WirePlumber moves the streams that follow the default device over to it by itself
+func (sf *pwSessionFinder) setDefaultDevice(name string, isOutput bool) error {
+	class := pwClassSource
+	if isOutput {
+		class = pwClassSink
+	}
+
+	sf.lock.Lock()
+
+	id, nodeName := -1, ""
+	for _, node := range sf.nodes {
+		if node.class != class {
+			continue
+		}
+
+		if strings.EqualFold(pwPropString(node.props, "node.name"), name) ||
+			strings.EqualFold(pwPropString(node.props, "node.description"), name) {
+
+			id, nodeName = node.id, pwPropString(node.props, "node.name")
+			break
+		}
+	}
+
+	sf.lock.Unlock()
+
+	if id < 0 {
+		return fmt.Errorf("no device node named %q", name)
+	}
+
+	if output, err := exec.Command(pwCtlCommand, "set-default", strconv.Itoa(id)).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s set-default %d: %w (%s)", pwCtlCommand, id, err, output)
+	}
+
+	// don't wait for pw-dump to announce the new default, so that the master (or mic) session we hand out
+	// right after this already controls it
+	sf.lock.Lock()
+	if isOutput {
+		sf.defaultSink = nodeName
+	} else {
+		sf.defaultSource = nodeName
+	}
+	sf.lock.Unlock()
+
+	return nil
+}
+
+// pwDeviceSessionNames returns the names a sink or source node's own sessions go by: its description, and its name
+func pwDeviceSessionNames(node *pwNode) []string {
+	names := []string{}
+
+	name := pwPropString(node.props, "node.name")
+	description := pwPropString(node.props, "node.description")
+
+	if description != "" && description != name {
+		names = append(names, description)
+	}
+
+	if name != "" {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// sinkNodeName looks a sink node up by its name or description, and returns its name
+func (sf *pwSessionFinder) sinkNodeName(sink string) (string, bool) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	for _, node := range sf.nodes {
+		if node.class != pwClassSink {
+			continue
+		}
+
+		name := pwPropString(node.props, "node.name")
+		if strings.EqualFold(name, sink) || strings.EqualFold(pwPropString(node.props, "node.description"), sink) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+func (c *pwControl) start() error {
+	cmd := exec.Command(pwCLICommand)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("get pw-cli input: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("get pw-cli output: %w", err)
+	}
+
+	cmd.Stderr = cmd.Stdout
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start pw-cli: %w", err)
+	}
+
+	output := make(chan string, pwCLIOutputBacklog)
+
+	c.cmd = cmd
+	c.stdin = stdin
+	c.output = output
+
+	go func() {
+		defer close(output)
+
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			output <- strings.TrimSpace(scanner.Text())
+		}
+
+		cmd.Wait()
+	}()
+
+	c.logger.Debugw("Started pw-cli", "pid", cmd.Process.Pid)
+
+	return nil
+}
+
+// run has pw-cli run a command, restarting it first if it stopped, and waits for pw-cli to get through it.
+// it fails if pw-cli reported an error while doing so
+func (c *pwControl) run(command string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cmd == nil {
+		if err := c.start(); err != nil {
+			return err
+		}
+	}
+
+	// whatever pw-cli printed since the last command isn't about this one
+	c.drainOutput()
+
+	c.commands++
+	marker := fmt.Sprintf("%s%d", pwCLIMarkerPrefix, c.commands)
+
+	if _, err := io.WriteString(c.stdin, command+"\n"+marker+"\n"); err != nil {
+		c.logger.Warnw("Lost pw-cli, will restart it for the next command", "error", err)
+		c.kill()
+
+		return fmt.Errorf("write pw-cli command: %w", err)
+	}
+
+	timeout := time.NewTimer(pwCLIReplyTimeout)
+	defer timeout.Stop()
+
+	failure := ""
+
+	for {
+		select {
+		case line, ok := <-c.output:
+			if !ok {
+				c.logger.Warn("pw-cli exited, will restart it for the next command")
+				c.kill()
+
+				return errors.New("pw-cli exited before running the command")
+			}
+
+			if strings.Contains(line, marker) {
+				if failure != "" {
+					return fmt.Errorf("pw-cli %q: %s", command, failure)
+				}
+
+				return nil
+			}
+
+			if failure == "" && pwCLIError(line) {
+				failure = line
+			}
+
+		case <-timeout.C:
+			c.logger.Warn("pw-cli stopped responding, will restart it for the next command")
+			c.kill()
+
+			return errors.New("no reply from pw-cli")
+		}
+	}
+}
+
+// drainOutput logs any errors pw-cli reported in between commands. assumes the lock is held
+func (c *pwControl) drainOutput() {
+	for {
+		select {
+		case line, ok := <-c.output:
+			if !ok {
+				return
+			}
+
+			if pwCLIError(line) {
+				c.logger.Warnw("pw-cli reported an error", "output", line)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (c *pwControl) stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cmd != nil {
+		c.kill()
+	}
+}
+
+// assumes the lock is held
+func (c *pwControl) kill() {
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+
+	// let the output reader get to the end, so that it can reap the process
+	go func(output chan string) {
+		for range output {
+		}
+	}(c.output)
+
+	c.cmd = nil
+	c.stdin = nil
+	c.output = nil
+}
+
+// pwCLIError tells whether a line pw-cli printed is about something going wrong
+func pwCLIError(line string) bool {
+	return strings.Contains(strings.ToLower(line), "error")
+}
+
+func pwPropInt(props map[string]interface{}, key string) int {
+	value, err := strconv.Atoi(pwPropString(props, key))
+	if err != nil {
+		return -1
+	}
+
+	return value
+}
+
+func pwPropString(props map[string]interface{}, key string) string {
+	value, ok := props[key]
+	if !ok || value == nil {
+		return ""
+	}
+
+	if str, ok := value.(string); ok {
+		return str
+	}
+
+	return strings.TrimSpace(fmt.Sprint(value))
+}
@@ -0,0 +1,98 @@
+package deej
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestPWSessionFinderUpdateSessions(t *testing.T) {
+	sink := func(id int, name string) *pwNode {
+		return &pwNode{id: id, class: pwClassSink, deviceID: -1, routeDevice: -1,
+			props: map[string]interface{}{"node.name": name, "node.description": name}}
+	}
+
+	stream := func(id int, binary string) *pwNode {
+		return &pwNode{id: id, class: pwClassOutputStream, deviceID: -1, routeDevice: -1,
+			props: map[string]interface{}{"application.process.binary": binary}}
+	}
+
+	tests := []struct {
+		name   string
+		change func(sf *pwSessionFinder)
+
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{
+			name:   "nothing changed",
+			change: func(sf *pwSessionFinder) {},
+		},
+		{
+			name:      "stream added",
+			change:    func(sf *pwSessionFinder) { sf.nodes[3] = stream(3, "spotify") },
+			wantAdded: []string{"spotify"},
+		},
+		{
+			name:        "stream removed",
+			change:      func(sf *pwSessionFinder) { delete(sf.nodes, 2) },
+			wantRemoved: []string{"firefox"},
+		},
+		{
+			name: "default sink changed",
+			change: func(sf *pwSessionFinder) {
+				sf.nodes[4] = sink(4, "headphones")
+				sf.defaultSink = "headphones"
+			},
+			wantAdded:   []string{"headphones", "master"},
+			wantRemoved: []string{"master"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sf := &pwSessionFinder{
+				logger:        zap.NewNop().Sugar(),
+				sessionLogger: zap.NewNop().Sugar(),
+				nodes:         map[int]*pwNode{1: sink(1, "speakers"), 2: stream(2, "firefox")},
+				defaultSink:   "speakers",
+				sessionEvents: make(chan sessionEvent, 1),
+			}
+
+			if _, err := sf.GetAllSessions(); err != nil {
+				t.Fatalf("GetAllSessions() error = %v", err)
+			}
+
+			tt.change(sf)
+			sf.updateSessions()
+
+			event := sessionEvent{}
+			select {
+			case event = <-sf.sessionEvents:
+			default:
+			}
+
+			if added := sessionKeys(event.added); !reflect.DeepEqual(added, sessionKeys(nil, tt.wantAdded...)) {
+				t.Errorf("updateSessions() added %v, want %v", added, tt.wantAdded)
+			}
+
+			if removed := sessionKeys(event.removed); !reflect.DeepEqual(removed, sessionKeys(nil, tt.wantRemoved...)) {
+				t.Errorf("updateSessions() removed %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+// sessionKeys returns the sorted keys of the given sessions, along with any extra keys
+func sessionKeys(sessions []Session, extra ...string) []string {
+	keys := append([]string{}, extra...)
+	for _, session := range sessions {
+		keys = append(keys, session.Key())
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
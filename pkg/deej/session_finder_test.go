@@ -0,0 +1,42 @@
+package deej
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSendSessionEvent(t *testing.T) {
+	added := sessionEvent{added: []Session{newTestSession("firefox", nil)}}
+	resync := sessionEvent{resync: true}
+
+	tests := []struct {
+		name    string
+		backlog int
+		queued  []sessionEvent
+		want    []sessionEvent
+	}{
+		{"room left", 2, nil, []sessionEvent{added}},
+		{"full queue is replaced by a resync", 2, []sessionEvent{added, added}, []sessionEvent{resync}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(chan sessionEvent, tt.backlog)
+			for _, event := range tt.queued {
+				events <- event
+			}
+
+			sendSessionEvent(events, added)
+			close(events)
+
+			got := []sessionEvent{}
+			for event := range events {
+				got = append(got, event)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sendSessionEvent() left %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -105,7 +105,11 @@ func withRetry(operation func() error) error {
 	return fmt.Errorf("operation failed after %d retries: %w", maxRetries, lastErr)
 }
 
-func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
+func newSessionFinder(logger *zap.SugaredLogger, config *CanonicalConfig) (SessionFinder, error) {
+	if config.AudioBackend != audioBackendPulseAudio {
+		logger.Warnw("Audio backend selection is Linux-only, ignoring", "key", configKeyAudioBackend, "value", config.AudioBackend)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Always clean up the context if we return an error
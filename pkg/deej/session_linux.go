@@ -3,6 +3,7 @@ package deej
 import (
 	"errors"
 	"fmt"
+	"sync"
 
 	"go.uber.org/zap"
 
@@ -21,8 +22,8 @@ type paSession struct {
 
 	client *proto.Client
 
-	sinkInputIndex    uint32
-	sinkInputChannels byte
+	sinkInputIndex uint32
+	channels       *paChannels
 }
 
 type masterSession struct {
@@ -30,28 +31,74 @@ type masterSession struct {
 
 	client *proto.Client
 
-	streamIndex    uint32
-	streamChannels byte
-	isOutput       bool
+	streamIndex uint32
+	channels    *paChannels
+	isOutput    bool
+}
+
+// paChannels is what a session knows about its stream's channels: where they're positioned, and how they're
+// balanced between left and right (-1 is left only, 1 is right only). volume changes keep that balance.
+// it's re-read from the stream before each change (see update), so that a balance set elsewhere (e.g. in
+// pavucontrol) is kept too. all sessions of a sink or source share the same one
+type paChannels struct {
+	lock       sync.Mutex
+	channelMap proto.ChannelMap
+	balance    float32
+}
+
+func newPAChannels(channelMap proto.ChannelMap, channelVolumes proto.ChannelVolumes) *paChannels {
+	c := &paChannels{}
+	c.update(channelMap, channelVolumes)
+
+	return c
+}
+
+// update picks up the stream's current channels and balance. a silent stream has no balance to go by,
+// so it keeps the last one it had
+func (c *paChannels) update(channelMap proto.ChannelMap, channelVolumes proto.ChannelVolumes) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.channelMap = channelMap
+
+	if parseChannelVolumes(channelVolumes) > 0 {
+		c.balance = parseChannelBalance(channelMap, channelVolumes)
+	}
+}
+
+func (c *paChannels) getBalance() float32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.balance
+}
+
+func (c *paChannels) setBalance(balance float32) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.balance = balance
 }
 
 func newPASession(
 	logger *zap.SugaredLogger,
 	client *proto.Client,
 	sinkInputIndex uint32,
-	sinkInputChannels byte,
+	channels *paChannels,
 	processName string,
+	properties map[string]string,
 ) *paSession {
 
 	s := &paSession{
-		client:            client,
-		sinkInputIndex:    sinkInputIndex,
-		sinkInputChannels: sinkInputChannels,
+		client:         client,
+		sinkInputIndex: sinkInputIndex,
+		channels:       channels,
 	}
 
 	s.processName = processName
 	s.name = processName
 	s.humanReadableDesc = processName
+	s.properties = properties
 
 	// use a self-identifying session name e.g. deej.sessions.chrome
 	s.logger = logger.Named(s.Key())
@@ -60,30 +107,50 @@ func newPASession(
 	return s
 }
 
+// newPASystemSession creates the system sounds session for a bell or notification sound's sink input
+func newPASystemSession(
+	logger *zap.SugaredLogger,
+	client *proto.Client,
+	sinkInputIndex uint32,
+	channels *paChannels,
+	properties map[string]string,
+) *paSession {
+
+	s := &paSession{
+		client:         client,
+		sinkInputIndex: sinkInputIndex,
+		channels:       channels,
+	}
+
+	s.system = true
+	s.name = systemSessionName
+	s.humanReadableDesc = "system sounds"
+	s.properties = properties
+
+	s.logger = logger.Named(s.Key())
+	s.logger.Debugw(sessionCreationLogMessage, "session", s)
+
+	return s
+}
+
 func newMasterSession(
 	logger *zap.SugaredLogger,
 	client *proto.Client,
 	streamIndex uint32,
-	streamChannels byte,
+	channels *paChannels,
 	isOutput bool,
+	key string,
+	loggerKey string,
 ) *masterSession {
 
 	s := &masterSession{
-		client:         client,
-		streamIndex:    streamIndex,
-		streamChannels: streamChannels,
-		isOutput:       isOutput,
-	}
-
-	var key string
-
-	if isOutput {
-		key = masterSessionName
-	} else {
-		key = inputSessionName
+		client:      client,
+		streamIndex: streamIndex,
+		channels:    channels,
+		isOutput:    isOutput,
 	}
 
-	s.logger = logger.Named(key)
+	s.logger = logger.Named(loggerKey)
 	s.master = true
 	s.name = key
 	s.humanReadableDesc = key
@@ -94,33 +161,129 @@ func newMasterSession(
 }
 
 func (s *paSession) GetVolume() float32 {
+	volumes, err := s.readChannels()
+	if err != nil {
+		s.logger.Warnw("Failed to get session volume", "error", err)
+	}
+
+	level := parseChannelVolumes(volumes)
+
+	return level
+}
+
+func (s *paSession) SetVolume(v float32) error {
+	if _, err := s.readChannels(); err != nil {
+		s.logger.Debugw("Failed to read session channels, keeping the last known balance", "error", err)
+	}
+
+	if err := s.writeVolume(v); err != nil {
+		s.logger.Warnw("Failed to set session volume", "error", err)
+		return fmt.Errorf("adjust session volume: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session volume", "to", fmt.Sprintf("%.2f", v))
+
+	return nil
+}
+
+// readChannels returns the sink input's current channel volumes, and picks up its balance from them
+func (s *paSession) readChannels() (proto.ChannelVolumes, error) {
 	request := proto.GetSinkInputInfo{
 		SinkInputIndex: s.sinkInputIndex,
 	}
 	reply := proto.GetSinkInputInfoReply{}
 
 	if err := s.client.Request(&request, &reply); err != nil {
-		s.logger.Warnw("Failed to get session volume", "error", err)
+		return nil, err
 	}
 
-	level := parseChannelVolumes(reply.ChannelVolumes)
+	s.channels.update(reply.ChannelMap, reply.ChannelVolumes)
 
-	return level
+	return reply.ChannelVolumes, nil
 }
 
-func (s *paSession) SetVolume(v float32) error {
-	volumes := createChannelVolumes(s.sinkInputChannels, v)
+// writeVolume sets the sink input's channels to the given level, at the balance we know of
+func (s *paSession) writeVolume(v float32) error {
 	request := proto.SetSinkInputVolume{
 		SinkInputIndex: s.sinkInputIndex,
-		ChannelVolumes: volumes,
+		ChannelVolumes: s.channels.volumes(v),
+	}
+
+	return s.client.Request(&request, nil)
+}
+
+func (s *paSession) GetMute() bool {
+	request := proto.GetSinkInputInfo{
+		SinkInputIndex: s.sinkInputIndex,
+	}
+	reply := proto.GetSinkInputInfoReply{}
+
+	if err := s.client.Request(&request, &reply); err != nil {
+		s.logger.Warnw("Failed to get session mute state", "error", err)
+		return false
+	}
+
+	return reply.Muted
+}
+
+func (s *paSession) SetMute(m bool) error {
+	request := proto.SetSinkInputMute{
+		SinkInputIndex: s.sinkInputIndex,
+		Mute:           m,
 	}
 
 	if err := s.client.Request(&request, nil); err != nil {
-		s.logger.Warnw("Failed to set session volume", "error", err)
-		return fmt.Errorf("adjust session volume: %w", err)
+		s.logger.Warnw("Failed to set session mute state", "error", err)
+		return fmt.Errorf("adjust session mute state: %w", err)
 	}
 
-	s.logger.Debugw("Adjusting session volume", "to", fmt.Sprintf("%.2f", v))
+	s.logger.Debugw("Adjusting session mute state", "to", m)
+
+	return nil
+}
+
+func (s *paSession) GetBalance() float32 {
+	if _, err := s.readChannels(); err != nil {
+		s.logger.Warnw("Failed to get session balance", "error", err)
+	}
+
+	return s.channels.getBalance()
+}
+
+// SetBalance keeps the session's level, and lowers either its left or right channels
+func (s *paSession) SetBalance(balance float32) error {
+	level := s.GetVolume()
+	s.channels.setBalance(balance)
+
+	if err := s.writeVolume(level); err != nil {
+		s.logger.Warnw("Failed to set session balance", "error", err)
+		return fmt.Errorf("adjust session balance: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session balance", "to", fmt.Sprintf("%.2f", balance))
+
+	return nil
+}
+
+// moveToSink sends the session's sink input to another sink. module-stream-restore remembers where we sent it,
+// so the app's future streams start out there too
+func (s *paSession) moveToSink(sink string) error {
+	info, err := findPASink(s.client, sink)
+	if err != nil {
+		return fmt.Errorf("move session: %w", err)
+	}
+
+	request := proto.MoveSinkInput{
+		SinkInputIndex: s.sinkInputIndex,
+		DeviceIndex:    info.SinkIndex,
+	}
+
+	if err := s.client.Request(&request, nil); err != nil {
+		s.logger.Warnw("Failed to move session", "sink", info.SinkName, "error", err)
+		return fmt.Errorf("move session: %w", err)
+	}
+
+	s.logger.Debugw("Moved session", "sink", info.SinkName)
 
 	return nil
 }
@@ -134,8 +297,35 @@ func (s *paSession) String() string {
 }
 
 func (s *masterSession) GetVolume() float32 {
-	var level float32
+	volumes, err := s.readChannels()
+	if err != nil {
+		s.logger.Warnw("Failed to get session volume", "error", err)
+		return 0
+	}
+
+	return parseChannelVolumes(volumes)
+}
+
+func (s *masterSession) SetVolume(v float32) error {
+	if _, err := s.readChannels(); err != nil {
+		s.logger.Debugw("Failed to read session channels, keeping the last known balance", "error", err)
+	}
 
+	if err := s.writeVolume(v); err != nil {
+		s.logger.Warnw("Failed to set session volume",
+			"error", err,
+			"volume", v)
+
+		return fmt.Errorf("adjust session volume: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session volume", "to", fmt.Sprintf("%.2f", v))
+
+	return nil
+}
+
+// readChannels returns the sink's (or source's) current channel volumes, and picks up its balance from them
+func (s *masterSession) readChannels() (proto.ChannelVolumes, error) {
 	if s.isOutput {
 		request := proto.GetSinkInfo{
 			SinkIndex: s.streamIndex,
@@ -143,32 +333,33 @@ func (s *masterSession) GetVolume() float32 {
 		reply := proto.GetSinkInfoReply{}
 
 		if err := s.client.Request(&request, &reply); err != nil {
-			s.logger.Warnw("Failed to get session volume", "error", err)
-			return 0
+			return nil, err
 		}
 
-		level = parseChannelVolumes(reply.ChannelVolumes)
-	} else {
-		request := proto.GetSourceInfo{
-			SourceIndex: s.streamIndex,
-		}
-		reply := proto.GetSourceInfoReply{}
+		s.channels.update(reply.ChannelMap, reply.ChannelVolumes)
 
-		if err := s.client.Request(&request, &reply); err != nil {
-			s.logger.Warnw("Failed to get session volume", "error", err)
-			return 0
-		}
+		return reply.ChannelVolumes, nil
+	}
 
-		level = parseChannelVolumes(reply.ChannelVolumes)
+	request := proto.GetSourceInfo{
+		SourceIndex: s.streamIndex,
 	}
+	reply := proto.GetSourceInfoReply{}
 
-	return level
+	if err := s.client.Request(&request, &reply); err != nil {
+		return nil, err
+	}
+
+	s.channels.update(reply.ChannelMap, reply.ChannelVolumes)
+
+	return reply.ChannelVolumes, nil
 }
 
-func (s *masterSession) SetVolume(v float32) error {
+// writeVolume sets the sink's (or source's) channels to the given level, at the balance we know of
+func (s *masterSession) writeVolume(v float32) error {
 	var request proto.RequestArgs
 
-	volumes := createChannelVolumes(s.streamChannels, v)
+	volumes := s.channels.volumes(v)
 
 	if s.isOutput {
 		request = &proto.SetSinkVolume{
@@ -182,15 +373,28 @@ func (s *masterSession) SetVolume(v float32) error {
 		}
 	}
 
-	if err := s.client.Request(request, nil); err != nil {
-		s.logger.Warnw("Failed to set session volume",
-			"error", err,
-			"volume", v)
+	return s.client.Request(request, nil)
+}
 
-		return fmt.Errorf("adjust session volume: %w", err)
+func (s *masterSession) GetBalance() float32 {
+	if _, err := s.readChannels(); err != nil {
+		s.logger.Warnw("Failed to get session balance", "error", err)
 	}
 
-	s.logger.Debugw("Adjusting session volume", "to", fmt.Sprintf("%.2f", v))
+	return s.channels.getBalance()
+}
+
+// SetBalance keeps the session's level, and lowers either its left or right channels
+func (s *masterSession) SetBalance(balance float32) error {
+	level := s.GetVolume()
+	s.channels.setBalance(balance)
+
+	if err := s.writeVolume(level); err != nil {
+		s.logger.Warnw("Failed to set session balance", "error", err)
+		return fmt.Errorf("adjust session balance: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session balance", "to", fmt.Sprintf("%.2f", balance))
 
 	return nil
 }
@@ -203,28 +407,102 @@ func (s *masterSession) String() string {
 	return fmt.Sprintf(sessionStringFormat, s.humanReadableDesc, s.GetVolume())
 }
 
-func createChannelVolumes(channels byte, volume float32) []uint32 {
-	volumes := make([]uint32, channels)
+// volumes creates channel volumes for the given level, lowering either the left or the right channels
+// to keep the balance
+func (c *paChannels) volumes(volume float32) []uint32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	volumes := make([]uint32, len(c.channelMap))
+
+	for i, position := range c.channelMap {
+		level := volume
 
-	for i := range volumes {
-		volumes[i] = uint32(volume * maxVolume)
+		if c.balance > 0 && channelIsLeft(position) {
+			level *= 1 - c.balance
+		} else if c.balance < 0 && channelIsRight(position) {
+			level *= 1 + c.balance
+		}
+
+		volumes[i] = uint32(level * maxVolume)
 	}
 
 	return volumes
 }
 
+// parseChannelVolumes returns a stream's overall level, which (like PulseAudio has it) is its loudest channel's.
+// that way, balancing a stream doesn't change its level
 func parseChannelVolumes(volumes []uint32) float32 {
 	var level uint32
 
 	for _, volume := range volumes {
-		level += volume
+		if volume > level {
+			level = volume
+		}
+	}
+
+	return float32(level) / float32(maxVolume)
+}
+
+// parseChannelBalance compares a stream's average left and right channel volumes, much like PulseAudio does
+func parseChannelBalance(channelMap proto.ChannelMap, volumes proto.ChannelVolumes) float32 {
+	var (
+		left, right   float32
+		lefts, rights int
+	)
+
+	for i, position := range channelMap {
+		if i >= len(volumes) {
+			break
+		}
+
+		if channelIsLeft(position) {
+			left += float32(volumes[i])
+			lefts++
+		} else if channelIsRight(position) {
+			right += float32(volumes[i])
+			rights++
+		}
+	}
+
+	if lefts == 0 || rights == 0 {
+		return 0
+	}
+
+	left /= float32(lefts)
+	right /= float32(rights)
+
+	switch {
+	case left > right:
+		return right/left - 1
+	case right > left:
+		return 1 - left/right
 	}
 
-	return float32(level) / float32(len(volumes)) / float32(maxVolume)
+	return 0
+}
+
+func channelIsLeft(position byte) bool {
+	switch position {
+	case proto.ChannelFrontLeft, proto.ChannelRearLeft, proto.ChannelLeftCenter, proto.ChannelLeftSide,
+		proto.ChannelTopFrontLeft, proto.ChannelTopRearLeft:
+		return true
+	}
+
+	return false
+}
+
+func channelIsRight(position byte) bool {
+	switch position {
+	case proto.ChannelFrontRight, proto.ChannelRearRight, proto.ChannelRightCenter, proto.ChannelRightSide,
+		proto.ChannelTopFrontRight, proto.ChannelTopRearRight:
+		return true
+	}
+
+	return false
 }
 
 func (s *masterSession) GetMute() bool {
-	var reply interface{}
 	if s.isOutput {
 		request := proto.GetSinkInfo{SinkIndex: s.streamIndex}
 		res := proto.GetSinkInfoReply{}
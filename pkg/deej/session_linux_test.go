@@ -0,0 +1,65 @@
+package deej
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestParseChannelBalance(t *testing.T) {
+	stereo := proto.ChannelMap{proto.ChannelFrontLeft, proto.ChannelFrontRight}
+	surround := proto.ChannelMap{
+		proto.ChannelFrontLeft, proto.ChannelFrontRight,
+		proto.ChannelFrontCenter, proto.ChannelLFE,
+		proto.ChannelRearLeft, proto.ChannelRearRight,
+	}
+
+	tests := []struct {
+		name       string
+		channelMap proto.ChannelMap
+		volumes    proto.ChannelVolumes
+		want       float32
+	}{
+		{"centred", stereo, proto.ChannelVolumes{0x10000, 0x10000}, 0},
+		{"right only", stereo, proto.ChannelVolumes{0, 0x10000}, 1},
+		{"left only", stereo, proto.ChannelVolumes{0x10000, 0}, -1},
+		{"half right", stereo, proto.ChannelVolumes{0x8000, 0x10000}, 0.5},
+		{"averages each side", surround, proto.ChannelVolumes{0x10000, 0x10000, 0, 0, 0x10000, 0}, -0.5},
+		{"mono has no balance", proto.ChannelMap{proto.ChannelMono}, proto.ChannelVolumes{0x10000}, 0},
+		{"fewer volumes than channels", stereo, proto.ChannelVolumes{0x10000}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseChannelBalance(tt.channelMap, tt.volumes); math.Abs(float64(got-tt.want)) > 1e-6 {
+				t.Errorf("parseChannelBalance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPAChannelsUpdate(t *testing.T) {
+	stereo := proto.ChannelMap{proto.ChannelFrontLeft, proto.ChannelFrontRight}
+
+	tests := []struct {
+		name    string
+		volumes proto.ChannelVolumes
+		want    float32
+	}{
+		{"balance changed elsewhere", proto.ChannelVolumes{maxVolume / 4, maxVolume}, 0.75},
+		{"centred elsewhere", proto.ChannelVolumes{maxVolume, maxVolume}, 0},
+		{"silent keeps the last balance", proto.ChannelVolumes{0, 0}, -0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channels := newPAChannels(stereo, proto.ChannelVolumes{maxVolume, maxVolume / 2})
+			channels.update(stereo, tt.volumes)
+
+			if got := channels.getBalance(); math.Abs(float64(got-tt.want)) > 1e-4 {
+				t.Errorf("update(%v) balance = %v, want %v", tt.volumes, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,12 @@ package deej
 
 import (
 	"fmt"
+	"path"
+	"reflect"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/omriharel/deej/pkg/deej/util"
@@ -22,7 +25,26 @@ type sessionMap struct {
 	sessionFinder SessionFinder
 
 	lastSessionRefresh time.Time
-	unmappedSessions   []Session
+
+	// guarded by lock, like m
+	unmappedSessions []Session
+
+	// set while the session finder reports sessions coming and going, which means we don't have to poll for them.
+	// written by followSessionEvents, and read whenever a slider moves
+	watching atomic.Bool
+
+	// signalled (without blocking) whenever the master session gets replaced, so that its feedback follows along
+	masterReplaced chan struct{}
+
+	// compiled regex targets, by pattern. invalid ones are kept as nil, so that we only complain about them once
+	patterns     map[string]*regexp.Regexp
+	patternsLock sync.Mutex
+
+	// the route each routed slider last sent its apps to, as an index into its routes, and the config it was
+	// last applied with (see applySliderRoutes)
+	routes        map[sliderRouteKey]int
+	appliedRoutes map[sliderRouteKey]appliedSliderRoutes
+	routesLock    sync.Mutex
 
 	// For tracking encoder rotation speed
 	lastEncoderEvent time.Time
@@ -38,12 +60,33 @@ const (
 	// this prefix identifies those targets to ensure they don't contradict with another similarly-named process
 	specialTargetTransformPrefix = "deej."
 
-	// targets the currently active window (Windows-only, experimental)
+	// targets the currently active window (experimental)
 	specialTargetCurrentWindow = "current"
 
 	// targets all currently unmapped sessions (experimental)
 	specialTargetAllUnmapped = "unmapped"
 
+	// these don't control any sessions. instead, button presses and encoder turns switch the default output
+	// (or input) device to the next (or previous) one listed in the config
+	specialTargetCycleOutput = "cycle_output"
+	specialTargetCycleInput  = "cycle_input"
+
+	// property targets match sessions by one of their properties rather than by key, e.g.
+	// "prop:application.name=firefox". "role:game" is short for "prop:media.role=game" (Linux-only)
+	propertyTargetPrefix = "prop:"
+	roleTargetPrefix     = "role:"
+	roleTargetProperty   = "media.role"
+
+	// pattern targets match every session whose key matches, e.g. "glob:*game*" or "re:^(wine|proton)".
+	// regex patterns are case-insensitive
+	globTargetPrefix  = "glob:"
+	regexTargetPrefix = "re:"
+
+	// balance targets shift their sessions' left/right balance with the slider, rather than their volume,
+	// e.g. "balance:master". slider positions this close to the centre leave the balance centred
+	balanceTargetPrefix = "balance:"
+	balanceDeadZone     = 0.05
+
 	// this threshold constant assumes that re-acquiring all sessions is a kind of expensive operation,
 	// and needs to be limited in some manner. this value was previously user-configurable through a config
 	// key "process_refresh_frequency", but exposing this type of implementation detail seems wrong now
@@ -53,14 +96,11 @@ const (
 	// this is a bit greedy but allows us to ensure sessions are always re-acquired, which is
 	// especially important for process groups (because you can have one ongoing session
 	// always preventing lookup of other processes bound to its slider, which forces the user
-	// to manually refresh sessions). a cleaner way to do this down the line is by registering to notifications
-	// whenever a new session is added, but that's too hard to justify for how easy this solution is
+	// to manually refresh sessions). session finders that report new sessions as they're added
+	// (see sessionWatcher) don't need any of this polling
 	maxTimeBetweenSessionRefreshes = time.Second * 45
 )
 
-// this matches friendly device names (on Windows), e.g. "Headphones (Realtek Audio)"
-var deviceSessionKeyPattern = regexp.MustCompile(`^.+ \(.+\)$`)
-
 func newSessionMap(deej *Deej, logger *zap.SugaredLogger, sessionFinder SessionFinder) (*sessionMap, error) {
 	logger = logger.Named("sessions")
 
@@ -69,6 +109,10 @@ func newSessionMap(deej *Deej, logger *zap.SugaredLogger, sessionFinder SessionF
 		logger:           logger,
 		m:                make(map[string][]Session),
 		lock:             &sync.Mutex{},
+		patterns:         make(map[string]*regexp.Regexp),
+		routes:           make(map[sliderRouteKey]int),
+		appliedRoutes:    make(map[sliderRouteKey]appliedSliderRoutes),
+		masterReplaced:   make(chan struct{}, 1),
 		sessionFinder:    sessionFinder,
 		lastEncoderEvent: time.Now(),
 		encoderSpeed:     0.0,
@@ -88,9 +132,50 @@ func (m *sessionMap) initialize() error {
 	m.setupOnConfigReload()
 	m.setupOnSliderMove()
 
+	m.applySliderRoutes()
+
+	if watcher, ok := m.sessionFinder.(sessionWatcher); ok {
+		m.watching.Store(true)
+		go m.followSessionEvents(watcher.subscribeToSessionEvents())
+	}
+
 	return nil
 }
 
+// followSessionEvents keeps the map up to date with sessions the session finder reports as they come and go
+func (m *sessionMap) followSessionEvents(events chan sessionEvent) {
+	m.logger.Debug("Following session events, no longer polling for sessions")
+
+	for event := range events {
+		if event.resync {
+			m.logger.Debug("Session finder lost track of sessions, refreshing")
+			m.refreshSessions(true)
+
+			continue
+		}
+
+		for _, session := range event.removed {
+			m.logger.Debugw("Session removed", "session", session)
+			m.remove(session)
+		}
+
+		for _, session := range event.added {
+			m.logger.Debugw("Session added", "session", session)
+			m.add(session)
+
+			if session.Key() == masterSessionName {
+				m.signalMasterReplaced()
+			}
+
+			m.trackIfUnmapped(session)
+			m.routeNewSession(session)
+		}
+	}
+
+	m.logger.Warn("Session finder stopped reporting sessions, going back to polling")
+	m.watching.Store(false)
+}
+
 func (m *sessionMap) release() error {
 	if err := m.sessionFinder.Release(); err != nil {
 		m.logger.Warnw("Failed to release session finder during session map release", "error", err)
@@ -106,7 +191,10 @@ func (m *sessionMap) getAndAddSessions() error {
 
 	// mark that we're refreshing before anything else
 	m.lastSessionRefresh = time.Now()
+
+	m.lock.Lock()
 	m.unmappedSessions = nil
+	m.lock.Unlock()
 
 	sessions, err := m.sessionFinder.GetAllSessions()
 	if err != nil {
@@ -116,14 +204,40 @@ func (m *sessionMap) getAndAddSessions() error {
 
 	for _, session := range sessions {
 		m.add(session)
-
-		if !m.sessionMapped(session) {
-			m.logger.Debugw("Tracking unmapped session", "session", session)
-			m.unmappedSessions = append(m.unmappedSessions, session)
-		}
+		m.trackIfUnmapped(session)
 	}
 
 	m.logger.Infow("Got all audio sessions successfully", "sessionMap", m)
+	m.signalMasterReplaced()
+
+	return nil
+}
+
+// trackIfUnmapped remembers the session for deej.unmapped, unless it's mapped to a slider
+func (m *sessionMap) trackIfUnmapped(session Session) {
+	if m.sessionMapped(session) {
+		return
+	}
+
+	m.logger.Debugw("Tracking unmapped session", "session", session)
+
+	m.lock.Lock()
+	m.unmappedSessions = append(m.unmappedSessions, session)
+	m.lock.Unlock()
+}
+
+func (m *sessionMap) signalMasterReplaced() {
+	select {
+	case m.masterReplaced <- struct{}{}:
+	default:
+	}
+}
+
+// subscribeToDeviceChanges returns the session finder's device change notifications, or nil if it has none
+func (m *sessionMap) subscribeToDeviceChanges() chan struct{} {
+	if notifier, ok := m.sessionFinder.(deviceChangeNotifier); ok {
+		return notifier.subscribeToDeviceChanges()
+	}
 
 	return nil
 }
@@ -137,13 +251,34 @@ func (m *sessionMap) setupOnConfigReload() {
 			case <-configReloadedChannel:
 				m.logger.Info("Detected config reload, attempting to re-acquire all audio sessions")
 				m.refreshSessions(false)
+
+				// routes could've been added or changed
+				m.applySliderRoutes()
+				for _, device := range m.deej.config.Devices {
+					if len(device.SliderRoutes) > 0 {
+						m.deej.resendSliderNames(device.Name)
+					}
+				}
 			}
 		}
 	}()
 }
 
 func (m *sessionMap) setupOnSliderMove() {
-	sliderEventsChannel := m.deej.serial.SubscribeToSliderMoveEvents()
+
+	// each device gets its own event stream, but they all end up adjusting the same sessions (and refreshing them),
+	// so they're merged into a single stream that's handled one event at a time
+	sliderEventsChannel := make(chan SliderMoveEvent, 32)
+
+	for _, serial := range m.deej.devices {
+		deviceEventsChannel := serial.SubscribeToSliderMoveEvents()
+
+		go func() {
+			for event := range deviceEventsChannel {
+				sliderEventsChannel <- event
+			}
+		}()
+	}
 
 	go func() {
 		for {
@@ -184,7 +319,7 @@ func (m *sessionMap) sessionMapped(session Session) bool {
 	}
 
 	// count device sessions as mapped
-	if deviceSessionKeyPattern.MatchString(session.Key()) {
+	if device, ok := session.(interface{ isDevice() bool }); ok && device.isDevice() {
 		return true
 	}
 
@@ -194,32 +329,51 @@ func (m *sessionMap) sessionMapped(session Session) bool {
 
 	matchFound := false
 
-	// look through the actual mappings
-	m.deej.config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
-		for _, target := range targets {
-
-			// ignore special transforms
-			if m.targetHasSpecialTransform(target) {
-				continue
+	// look through the actual mappings of every device
+	for _, device := range m.deej.config.Devices {
+		device.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+			if m.targetsMatch(targets, session) {
+				matchFound = true
 			}
+		})
+	}
 
-			// safe to assume this has a single element because we made sure there's no special transform
-			target = m.resolveTarget(target)[0]
+	return matchFound
+}
 
-			if target == session.Key() {
-				matchFound = true
-				return
+// targetsMatch tells whether a slider's targets explicitly include a session, meaning without special transforms
+func (m *sessionMap) targetsMatch(targets []string, session Session) bool {
+	for _, target := range targets {
+
+		// ignore special transforms
+		if m.targetHasSpecialTransform(target) {
+			continue
+		}
+
+		// safe to assume this has a single element because we made sure there's no special transform
+		target = m.resolveTarget(target)[0]
+
+		// property and pattern targets don't go by key
+		if matches, ok := m.targetMatcher(target); ok {
+			if matches(session) {
+				return true
 			}
+
+			continue
 		}
-	})
 
-	return matchFound
+		if target == session.Key() {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 
 	// first of all, ensure our session map isn't moldy
-	if m.lastSessionRefresh.Add(maxTimeBetweenSessionRefreshes).Before(time.Now()) {
+	if !m.watching.Load() && m.lastSessionRefresh.Add(maxTimeBetweenSessionRefreshes).Before(time.Now()) {
 		m.logger.Debug("Stale session map detected on slider move, refreshing")
 		m.refreshSessions(true)
 	}
@@ -265,17 +419,32 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 			"volumeDelta", baseVolumeDelta+(maxVolumeDelta-baseVolumeDelta)*speedFactor)
 	}
 
+	// get the config of the device this event came from. it could've been removed in a config reload
+	device, ok := m.deej.config.Device(event.Device)
+	if !ok {
+		return
+	}
+
 	// get the targets mapped to this slider from the config
-	targets, ok := m.deej.config.SliderMapping.get(event.SliderID)
+	targets, ok := device.SliderMapping.get(event.SliderID)
 
 	// if slider not found in config, silently ignore
 	if !ok {
 		return
 	}
 
+	// a routed slider's button sends its apps to the next sink, rather than muting them
+	if event.Command == "^" && len(device.SliderRoutes[event.SliderID]) > 0 {
+		m.routeSlider(device, event.SliderID)
+		return
+	}
+
 	targetFound := false
 	adjustmentFailed := false
 
+	// slider positions and encoder steps both go through the slider's volume curve
+	curve := device.SliderCurve(event.SliderID)
+
 	// Calculate volume delta based on encoder speed (only for + and -)
 	volumeDelta := float32(0.01) // Default small change
 	if event.Command == "+" || event.Command == "-" {
@@ -288,6 +457,29 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 	// for each possible target for this slider...
 	for _, target := range targets {
 
+		// device cycling targets ignore slider moves
+		if isOutput, ok := parseCycleTarget(target); ok {
+			switch event.Command {
+			case "+", "^":
+				m.cycleDefaultDevice(isOutput, 1)
+			case "-":
+				m.cycleDefaultDevice(isOutput, -1)
+			}
+
+			targetFound = true
+			continue
+		}
+
+		// balance targets leave the volume alone
+		if balanceTarget, ok := parseBalanceTarget(target); ok {
+			found, failed := m.adjustBalance(event, balanceTarget, volumeDelta)
+
+			targetFound = targetFound || found
+			adjustmentFailed = adjustmentFailed || failed
+
+			continue
+		}
+
 		// resolve the target name by cleaning it up and applying any special transformations.
 		// depending on the transformation applied, this can result in more than one target name
 		resolvedTargets := m.resolveTarget(target)
@@ -296,7 +488,7 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 		for _, resolvedTarget := range resolvedTargets {
 
 			// check the map for matching sessions
-			sessions, ok := m.get(resolvedTarget)
+			sessions, ok := m.find(resolvedTarget)
 
 			// no sessions matching this target - move on
 			if !ok {
@@ -310,10 +502,7 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 				switch event.Command {
 				case "+":
 					m.logger.Debugw("Increasing volume", "delta", volumeDelta)
-					newVolume := session.GetVolume() + volumeDelta
-					if newVolume > 1.0 {
-						newVolume = 1.0
-					}
+					newVolume := curve.step(session.GetVolume(), volumeDelta)
 
 					// If we're increasing volume from zero, make sure to unmute
 					if session.GetVolume() == 0 && session.GetMute() {
@@ -330,10 +519,7 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 					}
 				case "-":
 					m.logger.Debugw("Decreasing volume", "delta", volumeDelta)
-					newVolume := session.GetVolume() - volumeDelta
-					if newVolume < 0 {
-						newVolume = 0
-					}
+					newVolume := curve.step(session.GetVolume(), -volumeDelta)
 					if err := session.SetVolume(newVolume); err != nil {
 						m.logger.Warnw("Failed to set target session volume", "error", err)
 						adjustmentFailed = true
@@ -341,13 +527,12 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 				case "^":
 					session.SetMute(!session.GetMute())
 				default:
-					percentValue := event.PercentValue
-					if maxVolume, ok := m.deej.config.SliderMaxVolume[event.SliderID]; ok {
-						// Scale the volume to the configured max
-						percentValue = percentValue * (float32(maxVolume) / 100.0)
-						m.logger.Debugw("Applied max volume limit",
+					// this also scales the volume to the slider's configured max
+					percentValue := curve.apply(event.PercentValue)
+					if percentValue != event.PercentValue {
+						m.logger.Debugw("Applied volume curve",
 							"slider", event.SliderID,
-							"maxVolume", maxVolume,
+							"curve", curve,
 							"originalValue", event.PercentValue,
 							"scaledValue", percentValue)
 					}
@@ -364,9 +549,9 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 	}
 
 	// if we still haven't found a target or the volume adjustment failed, maybe look for the target again.
-	// processes could've opened since the last time this slider moved.
+	// processes could've opened since the last time this slider moved (unless we'd have heard about it).
 	// if they haven't, the cooldown will take care to not spam it up
-	if !targetFound {
+	if !targetFound && !m.watching.Load() {
 		m.refreshSessions(false)
 	} else if adjustmentFailed {
 
@@ -377,12 +562,337 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 	}
 }
 
+// parseCycleTarget tells whether a target is a device cycling one, and whether it cycles output devices
+func parseCycleTarget(target string) (bool, bool) {
+	switch strings.ToLower(target) {
+	case specialTargetTransformPrefix + specialTargetCycleOutput:
+		return true, true
+	case specialTargetTransformPrefix + specialTargetCycleInput:
+		return false, true
+	}
+
+	return false, false
+}
+
+// cycleDefaultDevice switches the default output (or input) device to the one after (or before) the current one
+// in the config's list. devices that can't be switched to (say, because they're unplugged) are skipped
+func (m *sessionMap) cycleDefaultDevice(isOutput bool, step int) {
+	candidates := m.deej.config.CycleInputDevices
+	configKey := configKeyCycleInputDevices
+	if isOutput {
+		candidates = m.deej.config.CycleOutputDevices
+		configKey = configKeyCycleOutputDevices
+	}
+
+	if len(candidates) == 0 {
+		m.logger.Warnw("No devices to cycle through, add some to the config", "key", configKey)
+		return
+	}
+
+	switcher, ok := m.sessionFinder.(defaultDeviceSwitcher)
+	if !ok {
+		m.logger.Warn("Switching the default device isn't supported on this platform")
+		return
+	}
+
+	// start from the current default device, or from either end of the list if it isn't on it
+	current := len(candidates)
+	if step > 0 {
+		current = -1
+	}
+
+	if names, err := switcher.getDefaultDevice(isOutput); err == nil {
+		for idx, candidate := range candidates {
+			if funk.Contains(names, func(name string) bool { return strings.EqualFold(name, candidate) }) {
+				current = idx
+				break
+			}
+		}
+	} else {
+		m.logger.Warnw("Failed to get current default device", "error", err)
+	}
+
+	for attempt := 1; attempt < len(candidates)+1; attempt++ {
+		next := candidates[((current+step*attempt)%len(candidates)+len(candidates))%len(candidates)]
+
+		if err := switcher.setDefaultDevice(next, isOutput); err != nil {
+			m.logger.Warnw("Failed to switch default device, trying the next one", "device", next, "error", err)
+			continue
+		}
+
+		m.logger.Infow("Switched default device", "device", next, "output", isOutput)
+
+		// a session finder that reports sessions as they change will re-bind master/mic by itself
+		if !m.watching.Load() {
+			m.refreshSessions(true)
+		}
+
+		return
+	}
+
+	m.logger.Warnw("Couldn't switch to any of the listed devices", "key", configKey)
+}
+
+// routeSlider moves a slider on to its next route, sends its apps there and shows it on the device's displays
+func (m *sessionMap) routeSlider(device *DeviceConfig, sliderIdx int) {
+	routes := device.SliderRoutes[sliderIdx]
+	key := sliderRouteKey{device: device.Name, slider: sliderIdx}
+
+	m.routesLock.Lock()
+	m.routes[key] = (m.routes[key] + 1) % len(routes)
+	route := routes[m.routes[key]]
+	m.routesLock.Unlock()
+
+	m.logger.Infow("Routing slider", "device", device.Name, "slider", sliderIdx, "route", route)
+
+	targets, _ := device.SliderMapping.get(sliderIdx)
+	for _, session := range m.routableSessions(targets) {
+		m.routeSession(session, route)
+	}
+
+	m.deej.resendSliderNames(device.Name)
+}
+
+// sliderRoute returns the route a slider currently sends its apps to, if it has any
+func (m *sessionMap) sliderRoute(device *DeviceConfig, sliderIdx int) (SliderRoute, bool) {
+	routes := device.SliderRoutes[sliderIdx]
+	if len(routes) == 0 {
+		return SliderRoute{}, false
+	}
+
+	m.routesLock.Lock()
+	defer m.routesLock.Unlock()
+
+	// the config could've been reloaded with fewer routes since
+	return routes[m.routes[sliderRouteKey{device: device.Name, slider: sliderIdx}]%len(routes)], true
+}
+
+// applySliderRoutes sends every routed slider's apps to its current route, which is its first one until its
+// button is pressed. this way, slider_routes doubles as a fixed routing profile. it runs on startup and on every
+// config reload, but only for sliders whose routes or targets changed since it last did: the others keep the route
+// their button picked, and apps moved elsewhere in the meantime stay there. a slider whose routes changed starts
+// over at its first one
+func (m *sessionMap) applySliderRoutes() {
+	configured := map[sliderRouteKey]bool{}
+
+	for _, device := range m.deej.config.Devices {
+		for sliderIdx, routes := range device.SliderRoutes {
+			key := sliderRouteKey{device: device.Name, slider: sliderIdx}
+			targets, _ := device.SliderMapping.get(sliderIdx)
+			applied := appliedSliderRoutes{routes: routes, targets: targets}
+
+			configured[key] = true
+
+			m.routesLock.Lock()
+			previous, ok := m.appliedRoutes[key]
+			unchanged := ok && previous.equal(applied)
+
+			if !unchanged {
+				m.appliedRoutes[key] = applied
+
+				// the route index only means something for the routes it was picked from
+				if !ok || !reflect.DeepEqual(previous.routes, routes) {
+					m.routes[key] = 0
+				}
+			}
+			m.routesLock.Unlock()
+
+			if unchanged {
+				continue
+			}
+
+			route, _ := m.sliderRoute(device, sliderIdx)
+			m.logger.Debugw("Applying slider routes", "device", device.Name, "slider", sliderIdx, "route", route)
+
+			for _, session := range m.routableSessions(targets) {
+				m.routeSession(session, route)
+			}
+		}
+	}
+
+	// sliders that lost their routes start over if they get them back
+	m.routesLock.Lock()
+	for key := range m.appliedRoutes {
+		if !configured[key] {
+			delete(m.appliedRoutes, key)
+			delete(m.routes, key)
+		}
+	}
+	m.routesLock.Unlock()
+}
+
+// routeNewSession sends a session that just showed up to the current route of a routed slider that controls it.
+// without session events, new sessions have to rely on the sound server remembering where their app was sent
+func (m *sessionMap) routeNewSession(session Session) {
+	if _, ok := session.(routableSession); !ok {
+		return
+	}
+
+	for _, device := range m.deej.config.Devices {
+		for sliderIdx := range device.SliderRoutes {
+			targets, _ := device.SliderMapping.get(sliderIdx)
+			if !m.targetsMatch(targets, session) {
+				continue
+			}
+
+			route, _ := m.sliderRoute(device, sliderIdx)
+			m.routeSession(session, route)
+
+			return
+		}
+	}
+}
+
+// routableSessions returns the app sessions that a slider's targets refer to and that can be sent elsewhere
+func (m *sessionMap) routableSessions(targets []string) []Session {
+	sessions := []Session{}
+
+	for _, target := range targets {
+		for _, resolvedTarget := range m.resolveTarget(target) {
+			found, _ := m.find(resolvedTarget)
+
+			for _, session := range found {
+				if device, ok := session.(interface{ isDevice() bool }); ok && device.isDevice() {
+					continue
+				}
+
+				if _, ok := session.(routableSession); ok {
+					sessions = append(sessions, session)
+				}
+			}
+		}
+	}
+
+	return sessions
+}
+
+func (m *sessionMap) routeSession(session Session, route SliderRoute) {
+	if err := session.(routableSession).moveToSink(route.Sink); err != nil {
+		m.logger.Warnw("Failed to route session", "session", session, "route", route, "error", err)
+	}
+}
+
+// sliderNames returns the slider names a device's displays should show, with each routed slider's current route
+func (m *sessionMap) sliderNames(device *DeviceConfig) string {
+	if len(device.SliderRoutes) == 0 {
+		return device.SliderNames
+	}
+
+	names := strings.Split(device.SliderNames, "|")
+
+	for sliderIdx := range device.SliderRoutes {
+		if sliderIdx < 0 {
+			continue
+		}
+
+		for len(names) <= sliderIdx {
+			names = append(names, "")
+		}
+
+		route, _ := m.sliderRoute(device, sliderIdx)
+		names[sliderIdx] = routedSliderName(names[sliderIdx], route)
+	}
+
+	return strings.Join(names, "|")
+}
+
+// adjustBalance sets the balance of the sessions a balance target refers to: according to the slider's position,
+// or by delta for encoder turns. the button centres it
+func (m *sessionMap) adjustBalance(event SliderMoveEvent, target string, delta float32) (bool, bool) {
+	found := false
+	failed := false
+
+	for _, resolvedTarget := range m.resolveTarget(target) {
+		sessions, ok := m.find(resolvedTarget)
+		if !ok {
+			continue
+		}
+
+		found = true
+
+		for _, session := range sessions {
+			balanced, ok := session.(balancedSession)
+			if !ok {
+				m.logger.Debugw("Session has no balance to adjust", "session", session)
+				continue
+			}
+
+			var balance float32
+
+			switch event.Command {
+			case "+":
+				balance = clampBalance(balanced.GetBalance() + delta)
+			case "-":
+				balance = clampBalance(balanced.GetBalance() - delta)
+			case "^":
+				balance = 0
+			default:
+				balance = sliderBalance(event.PercentValue)
+			}
+
+			if balance == balanced.GetBalance() {
+				continue
+			}
+
+			m.logger.Debugw("Adjusting session balance", "session", session, "to", fmt.Sprintf("%.2f", balance))
+
+			if err := balanced.SetBalance(balance); err != nil {
+				m.logger.Warnw("Failed to set target session balance", "error", err)
+				failed = true
+			}
+		}
+	}
+
+	return found, failed
+}
+
+// parseBalanceTarget returns the target a balance target refers to
+func parseBalanceTarget(target string) (string, bool) {
+	if len(target) <= len(balanceTargetPrefix) || !strings.EqualFold(target[:len(balanceTargetPrefix)], balanceTargetPrefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(target[len(balanceTargetPrefix):]), true
+}
+
+// sliderBalance turns a slider's position into a balance, with a dead zone around the centre.
+// the rest of the slider's travel is stretched so that it still reaches both ends
+func sliderBalance(value float32) float32 {
+	balance := value*2 - 1
+
+	switch {
+	case balance > balanceDeadZone:
+		return (balance - balanceDeadZone) / (1 - balanceDeadZone)
+	case balance < -balanceDeadZone:
+		return (balance + balanceDeadZone) / (1 - balanceDeadZone)
+	}
+
+	return 0
+}
+
+func clampBalance(balance float32) float32 {
+	if balance > 1 {
+		return 1
+	}
+
+	if balance < -1 {
+		return -1
+	}
+
+	return balance
+}
+
 func (m *sessionMap) targetHasSpecialTransform(target string) bool {
 	return strings.HasPrefix(target, specialTargetTransformPrefix)
 }
 
 func (m *sessionMap) resolveTarget(target string) []string {
 
+	// regex targets keep their case, which matters to escapes like \S and \W. they're matched case-insensitively instead
+	if strings.HasPrefix(target, regexTargetPrefix) {
+		return []string{target}
+	}
+
 	// start by ignoring the case
 	target = strings.ToLower(target)
 
@@ -394,6 +904,85 @@ func (m *sessionMap) resolveTarget(target string) []string {
 	return []string{target}
 }
 
+// targetMatcher returns a function that tells whether a session matches a resolved target, for targets that don't
+// go by a single key (property and pattern targets). it returns false for any other target
+func (m *sessionMap) targetMatcher(target string) (func(Session) bool, bool) {
+	if name, value, ok := parsePropertyTarget(target); ok {
+		return func(session Session) bool {
+			return sessionHasProperty(session, name, value)
+		}, true
+	}
+
+	if pattern := strings.TrimPrefix(target, globTargetPrefix); pattern != target {
+		return func(session Session) bool {
+			matched, err := path.Match(pattern, session.Key())
+			return err == nil && matched
+		}, true
+	}
+
+	if pattern := strings.TrimPrefix(target, regexTargetPrefix); pattern != target {
+		re := m.compilePattern(pattern)
+
+		return func(session Session) bool {
+			return re != nil && re.MatchString(session.Key())
+		}, true
+	}
+
+	return nil, false
+}
+
+func (m *sessionMap) compilePattern(pattern string) *regexp.Regexp {
+	m.patternsLock.Lock()
+	defer m.patternsLock.Unlock()
+
+	if re, ok := m.patterns[pattern]; ok {
+		return re
+	}
+
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		m.logger.Warnw("Invalid regex target, it won't match anything", "pattern", pattern, "error", err)
+		re = nil
+	}
+
+	m.patterns[pattern] = re
+
+	return re
+}
+
+// parsePropertyTarget splits a property target into the property's name and the value it should have
+func parsePropertyTarget(target string) (string, string, bool) {
+	if value := strings.TrimPrefix(target, roleTargetPrefix); value != target {
+		return roleTargetProperty, value, value != ""
+	}
+
+	property := strings.TrimPrefix(target, propertyTargetPrefix)
+	if property == target {
+		return "", "", false
+	}
+
+	name, value, ok := strings.Cut(property, "=")
+	if !ok || name == "" {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(name), strings.TrimSpace(value), true
+}
+
+func sessionHasProperty(session Session, name string, value string) bool {
+	propertySession, ok := session.(interface {
+		property(name string) (string, bool)
+	})
+
+	if !ok {
+		return false
+	}
+
+	actual, ok := propertySession.property(name)
+
+	return ok && strings.EqualFold(actual, value)
+}
+
 func (m *sessionMap) applyTargetTransform(specialTargetName string) []string {
 
 	// select the transformation based on its name
@@ -403,7 +992,7 @@ func (m *sessionMap) applyTargetTransform(specialTargetName string) []string {
 	case specialTargetCurrentWindow:
 		currentWindowProcessNames, err := util.GetCurrentWindowProcessNames()
 
-		// silently ignore errors here, as this is on deej's "hot path" (and it could just mean the user's running linux)
+		// silently ignore errors here, as this is on deej's "hot path" (and it could just mean there's no window system we support)
 		if err != nil {
 			return nil
 		}
@@ -418,6 +1007,9 @@ func (m *sessionMap) applyTargetTransform(specialTargetName string) []string {
 
 	// get currently unmapped sessions
 	case specialTargetAllUnmapped:
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
 		targetKeys := make([]string, len(m.unmappedSessions))
 		for sessionIdx, session := range m.unmappedSessions {
 			targetKeys[sessionIdx] = session.Key()
@@ -443,6 +1035,60 @@ func (m *sessionMap) add(value Session) {
 	}
 }
 
+// remove takes a single session out of the map and releases it
+func (m *sessionMap) remove(value Session) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := value.Key()
+	remaining := []Session{}
+
+	for _, session := range m.m[key] {
+		if session != value {
+			remaining = append(remaining, session)
+		}
+	}
+
+	if len(remaining) == 0 {
+		delete(m.m, key)
+	} else {
+		m.m[key] = remaining
+	}
+
+	for idx, session := range m.unmappedSessions {
+		if session == value {
+			m.unmappedSessions = append(m.unmappedSessions[:idx:idx], m.unmappedSessions[idx+1:]...)
+			break
+		}
+	}
+
+	value.Release()
+}
+
+// find returns the sessions a resolved target refers to: the ones under its key or, for property and pattern
+// targets, every session that matches
+func (m *sessionMap) find(target string) ([]Session, bool) {
+	matches, ok := m.targetMatcher(target)
+	if !ok {
+		return m.get(target)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	found := []Session{}
+
+	for _, sessions := range m.m {
+		for _, session := range sessions {
+			if matches(session) {
+				found = append(found, session)
+			}
+		}
+	}
+
+	return found, len(found) > 0
+}
+
 func (m *sessionMap) get(key string) ([]Session, bool) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -0,0 +1,148 @@
+package deej
+
+import (
+	"math"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// testSession is a session that only has a name and properties to go by
+type testSession struct {
+	baseSession
+}
+
+func newTestSession(name string, properties map[string]string) *testSession {
+	s := &testSession{}
+	s.name = name
+	s.properties = properties
+
+	return s
+}
+
+func (s *testSession) GetVolume() float32        { return 1 }
+func (s *testSession) SetVolume(v float32) error { return nil }
+func (s *testSession) GetMute() bool             { return false }
+func (s *testSession) SetMute(m bool) error      { return nil }
+func (s *testSession) Release()                  {}
+
+func TestParsePropertyTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		wantName  string
+		wantValue string
+		wantOK    bool
+	}{
+		{"property", "prop:application.name=firefox", "application.name", "firefox", true},
+		{"spaces around the parts", "prop: application.name = firefox ", "application.name", "firefox", true},
+		{"empty value", "prop:application.name=", "application.name", "", true},
+		{"role", "role:game", roleTargetProperty, "game", true},
+		{"role without a value", "role:", roleTargetProperty, "", false},
+		{"property without a value", "prop:application.name", "", "", false},
+		{"property without a name", "prop:=firefox", "", "", false},
+		{"plain target", "firefox", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, value, ok := parsePropertyTarget(tt.target)
+
+			if ok != tt.wantOK {
+				t.Fatalf("parsePropertyTarget(%q) ok = %v, want %v", tt.target, ok, tt.wantOK)
+			}
+
+			if ok && (name != tt.wantName || value != tt.wantValue) {
+				t.Errorf("parsePropertyTarget(%q) = %q, %q, want %q, %q", tt.target, name, value, tt.wantName, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestSessionHasProperty(t *testing.T) {
+	firefox := newTestSession("firefox", map[string]string{"application.name": "Firefox", "media.role": "music"})
+
+	tests := []struct {
+		name     string
+		session  Session
+		property string
+		value    string
+		want     bool
+	}{
+		{"match ignores case", firefox, "application.name", "firefox", true},
+		{"mismatch", firefox, "application.name", "chromium", false},
+		{"missing property", firefox, "application.process.binary", "firefox", false},
+		{"role", firefox, roleTargetProperty, "music", true},
+		{"no properties", newTestSession("firefox", nil), "application.name", "firefox", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionHasProperty(tt.session, tt.property, tt.value); got != tt.want {
+				t.Errorf("sessionHasProperty(%s=%s) = %v, want %v", tt.property, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetMatcher(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	m, _ := newSessionMap(&Deej{logger: logger}, logger, nil)
+
+	firefox := newTestSession("firefox", map[string]string{"application.name": "Firefox", "media.role": "music"})
+
+	tests := []struct {
+		name    string
+		target  string
+		session Session
+		wantOK  bool
+		want    bool
+	}{
+		{"glob match", "glob:*game*", newTestSession("mygame.exe", nil), true, true},
+		{"glob mismatch", "glob:*game*", newTestSession("discord.exe", nil), true, false},
+		{"regex match", "re:^(wine|proton)", newTestSession("wine64-preloader", nil), true, true},
+		{"regex ignores case", "re:^WINE", newTestSession("wine.exe", nil), true, true},
+		{"invalid regex matches nothing", "re:(", newTestSession("(", nil), true, false},
+		{"property", "prop:application.name=firefox", firefox, true, true},
+		{"role", "role:game", firefox, true, false},
+		{"plain target", "firefox", firefox, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, ok := m.targetMatcher(tt.target)
+
+			if ok != tt.wantOK {
+				t.Fatalf("targetMatcher(%q) ok = %v, want %v", tt.target, ok, tt.wantOK)
+			}
+
+			if ok && matches(tt.session) != tt.want {
+				t.Errorf("targetMatcher(%q) matches %v = %v, want %v", tt.target, tt.session.Key(), !tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestSliderBalance(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float32
+		want  float32
+	}{
+		{"left end", 0, -1},
+		{"right end", 1, 1},
+		{"centre", 0.5, 0},
+		{"inside the dead zone", 0.52, 0},
+		{"just past the dead zone", 0.53, 0.01053},
+		{"halfway right", 0.7625, 0.5},
+		{"halfway left", 0.2375, -0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sliderBalance(tt.value); math.Abs(float64(got-tt.want)) > 1e-4 {
+				t.Errorf("sliderBalance(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
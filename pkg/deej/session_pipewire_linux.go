@@ -0,0 +1,115 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+type pwSession struct {
+	baseSession
+
+	finder *pwSessionFinder
+	nodeID int
+}
+
+func newPWSession(
+	logger *zap.SugaredLogger,
+	finder *pwSessionFinder,
+	nodeID int,
+	name string,
+	master bool,
+	properties map[string]string,
+) *pwSession {
+
+	s := &pwSession{
+		finder: finder,
+		nodeID: nodeID,
+	}
+
+	s.master = master
+	s.name = name
+	s.humanReadableDesc = name
+	s.properties = properties
+
+	// use a self-identifying session name e.g. deej.sessions.chrome
+	s.logger = logger.Named(s.Key())
+	s.logger.Debugw(sessionCreationLogMessage, "session", s)
+
+	return s
+}
+
+// GetVolume returns the node's volume the way pavucontrol or wpctl would show it. PipeWire stores
+// linear channel volumes, which are the cube of that
+func (s *pwSession) GetVolume() float32 {
+	volumes, _, ok := s.finder.levels(s.nodeID)
+	if !ok || len(volumes) == 0 {
+		return 0
+	}
+
+	var level float64
+	for _, volume := range volumes {
+		level += math.Cbrt(volume)
+	}
+
+	return float32(level / float64(len(volumes)))
+}
+
+func (s *pwSession) SetVolume(v float32) error {
+	if err := s.finder.setVolume(s.nodeID, v); err != nil {
+		s.logger.Warnw("Failed to set session volume", "error", err, "volume", v)
+		return fmt.Errorf("adjust session volume: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session volume", "to", fmt.Sprintf("%.2f", v))
+
+	return nil
+}
+
+func (s *pwSession) GetMute() bool {
+	_, mute, ok := s.finder.levels(s.nodeID)
+	return ok && mute
+}
+
+func (s *pwSession) SetMute(m bool) error {
+	if err := s.finder.setMute(s.nodeID, m); err != nil {
+		s.logger.Warnw("Failed to set mute", "error", err)
+		return fmt.Errorf("adjust session mute: %w", err)
+	}
+
+	return nil
+}
+
+// moveToSink sends the stream node to another sink by setting its target.object metadata, which is also what
+// WirePlumber restores the app's future streams to
+func (s *pwSession) moveToSink(sink string) error {
+	if s.master {
+		return fmt.Errorf("move session: %s is a device", s.name)
+	}
+
+	name, ok := s.finder.sinkNodeName(sink)
+	if !ok {
+		return fmt.Errorf("move session: no sink node named %q", sink)
+	}
+
+	args := []string{strconv.Itoa(s.nodeID), "target.object", name}
+	if output, err := exec.Command(pwMetadataCommand, args...).CombinedOutput(); err != nil {
+		s.logger.Warnw("Failed to move session", "sink", name, "error", err)
+		return fmt.Errorf("move session: %s %v: %w (%s)", pwMetadataCommand, args, err, output)
+	}
+
+	s.logger.Debugw("Moved session", "sink", name)
+
+	return nil
+}
+
+func (s *pwSession) Release() {
+	s.logger.Debug("Releasing audio session")
+}
+
+func (s *pwSession) String() string {
+	return fmt.Sprintf(sessionStringFormat, s.humanReadableDesc, s.GetVolume())
+}
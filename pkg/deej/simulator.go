@@ -0,0 +1,280 @@
+package deej
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// simulatedMixer behaves like a board running the deejx sketch (speaking the text protocol), on the far end
+// of a pseudo-terminal. deej connects to the pty like it would to any serial port. the mixer moves its own
+// controls around: sliders drift between random positions, the encoder turns and the button gets clicked
+// every now and then. whatever deej sends back to its displays is logged
+type simulatedMixer struct {
+	logger *zap.SugaredLogger
+
+	master *os.File // the mixer's end
+	slave  *os.File // deej's end, which we hold on to so that the master stays usable between connections
+
+	lock          sync.Mutex
+	sliders       []int
+	targets       []int
+	names         []string
+	masterVolume  int
+	mute          bool
+	lastKeepAlive time.Time
+	screensActive bool
+
+	stopChannel chan bool
+}
+
+const (
+	simulatorFirmware = "1.1.0-sim"
+	simulatorDeviceID = "SIMULATE"
+	simulatorControls = "ESSS"
+	simulatorDisplays = 4
+
+	simulatorTickInterval   = 50 * time.Millisecond
+	simulatorSliderStep     = 2   // percent per tick, while moving
+	simulatorSliderRestOdds = 100 // a resting slider starts moving on one of this many ticks, on average
+	simulatorEncoderOdds    = 120 // the encoder turns on one of this many ticks, on average
+	simulatorButtonOdds     = 600 // the button gets clicked on one of this many ticks, on average
+
+	// the sketch blanks its displays when it hasn't heard from the host for this long
+	simulatorKeepAliveTimeout = 10 * time.Second
+
+	// writes block while nobody's reading deej's end, and we'd rather drop lines than stop moving
+	simulatorWriteTimeout = 100 * time.Millisecond
+)
+
+func newSimulatedMixer(logger *zap.SugaredLogger) (*simulatedMixer, error) {
+	logger = logger.Named("simulator")
+
+	master, slave, err := util.OpenPTY()
+	if err != nil {
+		return nil, fmt.Errorf("open simulator pty: %w", err)
+	}
+
+	numSliders := strings.Count(simulatorControls, string(ControlSlider))
+
+	m := &simulatedMixer{
+		logger:      logger,
+		master:      master,
+		slave:       slave,
+		sliders:     make([]int, numSliders),
+		targets:     make([]int, numSliders),
+		names:       []string{},
+		stopChannel: make(chan bool),
+	}
+
+	for idx := range m.sliders {
+		m.sliders[idx] = rand.Intn(101)
+		m.targets[idx] = m.sliders[idx]
+	}
+
+	logger.Infow("Created simulated mixer", "port", m.Port())
+
+	return m, nil
+}
+
+// Port returns the path of the serial port deej should connect to
+func (m *simulatedMixer) Port() string {
+	return m.slave.Name()
+}
+
+func (m *simulatedMixer) start() {
+	go m.readCommands()
+	go m.moveControls()
+}
+
+func (m *simulatedMixer) stop() {
+	close(m.stopChannel)
+	m.master.Close()
+	m.slave.Close()
+}
+
+func (m *simulatedMixer) moveControls() {
+	ticker := time.NewTicker(simulatorTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChannel:
+			return
+		case <-ticker.C:
+		}
+
+		m.lock.Lock()
+
+		moved := false
+		for idx, value := range m.sliders {
+			target := m.targets[idx]
+
+			if value == target {
+				if rand.Intn(simulatorSliderRestOdds) == 0 {
+					m.targets[idx] = rand.Intn(101)
+				}
+
+				continue
+			}
+
+			step := target - value
+			if step > simulatorSliderStep {
+				step = simulatorSliderStep
+			} else if step < -simulatorSliderStep {
+				step = -simulatorSliderStep
+			}
+
+			m.sliders[idx] += step
+			moved = true
+		}
+
+		if m.screensActive && time.Since(m.lastKeepAlive) > simulatorKeepAliveTimeout {
+			m.logger.Info("No keep-alive from deej, blanking simulated displays")
+			m.screensActive = false
+		}
+
+		m.lock.Unlock()
+
+		switch {
+		case rand.Intn(simulatorButtonOdds) == 0:
+			m.sendControls('^')
+		case rand.Intn(simulatorEncoderOdds) == 0:
+			m.sendControls([]byte{'+', '-'}[rand.Intn(2)])
+		case moved:
+			m.sendControls('=')
+		}
+	}
+}
+
+// sendControls sends a slider line, the same way the sketch does: the encoder/button command followed by all sliders
+func (m *simulatedMixer) sendControls(command byte) {
+	m.lock.Lock()
+	fields := []string{string(command)}
+	for _, value := range m.sliders {
+		fields = append(fields, strconv.Itoa(value))
+	}
+	m.lock.Unlock()
+
+	m.writeLine(strings.Join(fields, "|"))
+}
+
+func (m *simulatedMixer) writeLine(line string) {
+	m.master.SetWriteDeadline(time.Now().Add(simulatorWriteTimeout))
+
+	if _, err := m.master.Write([]byte(line + "\r\n")); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		m.logger.Debugw("Failed to write simulated line", "line", line, "error", err)
+	}
+}
+
+// readCommands reads host messages, which are delimited by '<' and '>'
+func (m *simulatedMixer) readCommands() {
+	var (
+		buf     = make([]byte, 256)
+		pending []byte
+	)
+
+	for {
+		n, err := m.master.Read(buf)
+		if err != nil {
+			select {
+			case <-m.stopChannel:
+			default:
+				m.logger.Warnw("Failed to read from simulator pty, stopping", "error", err)
+			}
+
+			return
+		}
+
+		pending = append(pending, buf[:n]...)
+
+		for {
+			start := bytes.IndexByte(pending, '<')
+			if start < 0 {
+				pending = pending[:0]
+				break
+			}
+
+			end := bytes.IndexByte(pending[start:], '>')
+			if end < 0 {
+				pending = pending[start:]
+				break
+			}
+
+			m.handleCommand(string(pending[start+1 : start+end]))
+			pending = pending[start+end+1:]
+		}
+	}
+}
+
+func (m *simulatedMixer) handleCommand(command string) {
+	if command == "" {
+		m.writeLine("Error: Empty command received")
+		return
+	}
+
+	data := command[1:]
+
+	switch command[0] {
+	case '!':
+		parts := strings.Split(data, "|")
+		if len(parts) != 2 {
+			m.writeLine("Error: Invalid mute command format")
+			return
+		}
+
+		mute, _ := strconv.Atoi(parts[0])
+		volume, _ := strconv.Atoi(parts[1])
+
+		m.lock.Lock()
+		m.mute = mute == 1
+		m.masterVolume = volume
+		m.lock.Unlock()
+
+		m.logger.Infow("Simulated master display updated", "volume", volume, "muted", mute == 1)
+		m.writeLine("&!")
+
+	case '^':
+		names := strings.Split(data, "|")
+
+		m.lock.Lock()
+		m.names = names
+		m.lock.Unlock()
+
+		m.logger.Infow("Simulated slider names updated", "names", names)
+		m.writeLine("Parsed name list")
+		m.writeLine("&^")
+
+	case '#':
+		m.lock.Lock()
+		m.lastKeepAlive = time.Now()
+		if !m.screensActive {
+			m.logger.Info("Keep-alive from deej, waking simulated displays")
+			m.screensActive = true
+		}
+		m.lock.Unlock()
+
+		m.writeLine("Keep-alive signal received")
+		m.writeLine("&#")
+
+	case '?':
+		m.writeLine(fmt.Sprintf("%sdeejx|%s|%s|%s|%d",
+			capabilitiesLinePrefix, simulatorFirmware, simulatorDeviceID, simulatorControls, simulatorDisplays))
+
+	case '~':
+		// the framed protocol isn't simulated, so stay quiet like a sketch that doesn't know it
+
+	default:
+		m.writeLine("Unknown command")
+	}
+}
@@ -0,0 +1,236 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SliderFilterConfig configures the chain of filters that raw slider readings go through before they're
+// applied. the filters run in this order, and each one is disabled by its zero value:
+//
+// median-of-N (Median readings), exponential moving average (EMA is the weight of the newest reading),
+// end snapping (readings within Snap of 0 or 1 become 0 or 1) and deadband (readings that differ from the
+// last applied value by less than Deadband are dropped, except for ones that land exactly on 0 or 1)
+type SliderFilterConfig struct {
+	Median   int
+	EMA      float32
+	Snap     float32
+	Deadband float32
+}
+
+const (
+	configKeySliderFilters = "slider_filters"
+
+	// keys within a single slider's filter config
+	sliderFilterKeyPreset   = "preset"
+	sliderFilterKeyMedian   = "median"
+	sliderFilterKeyEMA      = "ema"
+	sliderFilterKeySnap     = "snap"
+	sliderFilterKeyDeadband = "deadband"
+
+	noiseReductionOff     = "off"
+	noiseReductionLow     = "low"
+	noiseReductionDefault = "default"
+	noiseReductionHigh    = "high"
+
+	// the largest median window we'll keep around
+	maxSliderFilterMedian = 15
+
+	// smoothed values this close to the last reading round to the same percentage, so there's nothing left to settle
+	sliderFilterSettledDistance = 0.005
+)
+
+// the noise_reduction levels. a deadband should be a median value between two round percent values,
+// for instance 0.025 means volume can move at 3% increments
+var sliderFilterPresets = map[string]SliderFilterConfig{
+	noiseReductionOff:     {},
+	noiseReductionLow:     {Deadband: 0.015},
+	noiseReductionDefault: {Deadband: 0.025},
+	noiseReductionHigh:    {Median: 3, Deadband: 0.035},
+}
+
+// sliderFilterPreset returns the preset of the given name, or the default one if there's no such preset
+func sliderFilterPreset(name string) (SliderFilterConfig, bool) {
+	preset, ok := sliderFilterPresets[strings.ToLower(name)]
+	if !ok {
+		return sliderFilterPresets[noiseReductionDefault], false
+	}
+
+	return preset, true
+}
+
+// parseSliderFilterConfig reads a single slider's filter config, which is either the name of a preset or a map
+// of filter settings (optionally based on a preset, which the other settings then override)
+func parseSliderFilterConfig(value interface{}, fallback SliderFilterConfig) (SliderFilterConfig, error) {
+	if presetName, ok := value.(string); ok {
+		preset, ok := sliderFilterPreset(presetName)
+		if !ok {
+			return fallback, fmt.Errorf("unknown preset %q", presetName)
+		}
+
+		return preset, nil
+	}
+
+	settings, ok := value.(map[string]interface{})
+	if !ok {
+		return fallback, fmt.Errorf("expected a preset name or a map of filter settings, got %T", value)
+	}
+
+	config := fallback
+
+	if presetName, ok := settings[sliderFilterKeyPreset]; ok {
+		preset, ok := sliderFilterPreset(fmt.Sprint(presetName))
+		if !ok {
+			return fallback, fmt.Errorf("unknown preset %q", presetName)
+		}
+
+		config = preset
+	}
+
+	for key, rawSetting := range settings {
+		if key == sliderFilterKeyPreset {
+			continue
+		}
+
+		setting, err := strconv.ParseFloat(fmt.Sprint(rawSetting), 32)
+		if err != nil || setting < 0 {
+			return fallback, fmt.Errorf("invalid %s value %v", key, rawSetting)
+		}
+
+		switch key {
+		case sliderFilterKeyMedian:
+			config.Median = int(setting)
+			if config.Median > maxSliderFilterMedian {
+				return fallback, fmt.Errorf("median window can't be larger than %d", maxSliderFilterMedian)
+			}
+		case sliderFilterKeyEMA:
+			if setting > 1 {
+				return fallback, fmt.Errorf("ema weight must be between 0 and 1, got %v", rawSetting)
+			}
+			config.EMA = float32(setting)
+		case sliderFilterKeySnap:
+			config.Snap = float32(setting)
+		case sliderFilterKeyDeadband:
+			config.Deadband = float32(setting)
+		default:
+			return fallback, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+
+	return config, nil
+}
+
+func (sfc SliderFilterConfig) String() string {
+	return fmt.Sprintf("<median %d, ema %.2f, snap %.3f, deadband %.3f>", sfc.Median, sfc.EMA, sfc.Snap, sfc.Deadband)
+}
+
+// sliderFilterChain holds the state of a single slider's filters between readings
+type sliderFilterChain struct {
+	config SliderFilterConfig
+
+	window []float32 // most recent readings, oldest first
+	ema    float32   // negative until the first reading
+
+	lastReading float32 // negative until the first reading
+
+	lastApplied float32 // negative until the first reading goes through
+}
+
+func newSliderFilterChain(config SliderFilterConfig) *sliderFilterChain {
+	return &sliderFilterChain{
+		config:      config,
+		ema:         -1,
+		lastReading: -1,
+		lastApplied: -1,
+	}
+}
+
+// process runs a normalized reading through the chain. it returns the filtered value, and whether
+// it's different enough from the last one that went through to be applied
+func (c *sliderFilterChain) process(reading float32) (float32, bool) {
+	c.lastReading = reading
+	value := reading
+
+	if c.config.Median > 1 {
+		c.window = append(c.window, value)
+		if len(c.window) > c.config.Median {
+			c.window = c.window[1:]
+		}
+
+		sorted := append([]float32{}, c.window...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		value = sorted[len(sorted)/2]
+	}
+
+	if c.config.EMA > 0 && c.config.EMA < 1 {
+		if c.ema < 0 {
+			c.ema = value
+		} else {
+			c.ema = c.config.EMA*value + (1-c.config.EMA)*c.ema
+		}
+
+		value = c.ema
+	}
+
+	if c.config.Snap > 0 {
+		if value <= c.config.Snap {
+			value = 0
+		} else if value >= 1-c.config.Snap {
+			value = 1
+		}
+	}
+
+	// smoothing leaves us with values between round percentages, which nothing else deals in
+	value = float32(math.Round(float64(value)*100) / 100)
+
+	if c.lastApplied >= 0 && !c.significantlyDifferent(value) {
+		return c.lastApplied, false
+	}
+
+	c.lastApplied = value
+
+	return value, true
+}
+
+// settled reports whether the median and EMA filters have caught up with the last reading. devices only send
+// readings when something changes, so a slider that stops moving doesn't send the readings these need to get there
+func (c *sliderFilterChain) settled() bool {
+	if c.lastReading < 0 {
+		return true
+	}
+
+	if c.config.Median > 1 {
+		for _, reading := range c.window {
+			if reading != c.lastReading {
+				return false
+			}
+		}
+	}
+
+	if c.config.EMA > 0 && c.config.EMA < 1 {
+		return math.Abs(float64(c.ema-c.lastReading)) < sliderFilterSettledDistance
+	}
+
+	return true
+}
+
+// settle runs the last reading through the chain again, as if the device sent it once more
+func (c *sliderFilterChain) settle() (float32, bool) {
+	return c.process(c.lastReading)
+}
+
+func (c *sliderFilterChain) significantlyDifferent(value float32) bool {
+	if value == c.lastApplied {
+		return false
+	}
+
+	if math.Abs(float64(value-c.lastApplied)) >= float64(c.config.Deadband) {
+		return true
+	}
+
+	// let the ends through even when they're within the deadband, so sliders can always reach 0% and 100%
+	return value == 0 || value == 1
+}
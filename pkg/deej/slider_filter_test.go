@@ -0,0 +1,107 @@
+package deej
+
+import "testing"
+
+func TestSliderFilterChain(t *testing.T) {
+	type result struct {
+		value   float32
+		applied bool
+	}
+
+	tests := []struct {
+		name     string
+		config   SliderFilterConfig
+		readings []float32
+		want     []result
+	}{
+		{
+			name:     "no filters only rounds",
+			config:   SliderFilterConfig{},
+			readings: []float32{0.5, 0.503, 0.51},
+			want:     []result{{0.5, true}, {0.5, false}, {0.51, true}},
+		},
+		{
+			name:     "deadband",
+			config:   SliderFilterConfig{Deadband: 0.025},
+			readings: []float32{0.5, 0.52, 0.53, 0.01, 0},
+			want:     []result{{0.5, true}, {0.5, false}, {0.53, true}, {0.01, true}, {0, true}},
+		},
+		{
+			name:     "deadband lets the top through",
+			config:   SliderFilterConfig{Deadband: 0.025},
+			readings: []float32{0.99, 1},
+			want:     []result{{0.99, true}, {1, true}},
+		},
+		{
+			name:     "median drops a spike",
+			config:   SliderFilterConfig{Median: 3},
+			readings: []float32{0.5, 0.5, 0.9, 0.5},
+			want:     []result{{0.5, true}, {0.5, false}, {0.5, false}, {0.5, false}},
+		},
+		{
+			name:     "ema",
+			config:   SliderFilterConfig{EMA: 0.5},
+			readings: []float32{0, 1, 1},
+			want:     []result{{0, true}, {0.5, true}, {0.75, true}},
+		},
+		{
+			name:     "snap",
+			config:   SliderFilterConfig{Snap: 0.02},
+			readings: []float32{0.015, 0.5, 0.985},
+			want:     []result{{0, true}, {0.5, true}, {1, true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := newSliderFilterChain(tt.config)
+
+			for idx, reading := range tt.readings {
+				value, applied := chain.process(reading)
+
+				if got := (result{value, applied}); got != tt.want[idx] {
+					t.Errorf("reading %d (%v): got %+v, want %+v", idx, reading, got, tt.want[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestSliderFilterChainSettle(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   SliderFilterConfig
+		readings []float32
+	}{
+		{"ema", SliderFilterConfig{EMA: 0.3, Deadband: 0.015}, []float32{0, 1}},
+		{"median", SliderFilterConfig{Median: 5}, []float32{0, 0, 0, 1}},
+		{"both", SliderFilterConfig{Median: 3, EMA: 0.5}, []float32{1, 0.2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := newSliderFilterChain(tt.config)
+
+			for _, reading := range tt.readings {
+				chain.process(reading)
+			}
+
+			if chain.settled() {
+				t.Fatal("settled() = true right after the slider moved")
+			}
+
+			for attempt := 0; !chain.settled(); attempt++ {
+				if attempt == 100 {
+					t.Fatal("chain never settled")
+				}
+
+				chain.settle()
+			}
+
+			last := tt.readings[len(tt.readings)-1]
+			if chain.lastApplied != last {
+				t.Errorf("settled on %v, want %v", chain.lastApplied, last)
+			}
+		})
+	}
+}
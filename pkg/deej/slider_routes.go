@@ -0,0 +1,143 @@
+package deej
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// sliderRouteKey identifies a slider across all devices
+type sliderRouteKey struct {
+	device string
+	slider int
+}
+
+// appliedSliderRoutes is the config a routed slider's apps were last sent along with: its routes and its targets
+type appliedSliderRoutes struct {
+	routes  []SliderRoute
+	targets []string
+}
+
+// SliderRoute is one of the output devices a slider's apps can be sent to, by its description or name
+type SliderRoute struct {
+	Sink string
+
+	// shown next to the slider's name on its display. defaults to the sink itself
+	Label string
+}
+
+const (
+	configKeySliderRoutes = "slider_routes"
+
+	// keys within a single route's config
+	sliderRouteKeySink  = "sink"
+	sliderRouteKeyLabel = "label"
+
+	// the sketch doesn't show more than this many characters of a slider's name (counting each rune as one)
+	maxSliderNameLength = 19
+
+	sliderRouteNameSeparator = ">"
+)
+
+// parseSliderRoutes reads a single slider's routes, which is either a single sink or a list of them. each sink is
+// either its description or name, or a map with a sink and a label
+func parseSliderRoutes(value interface{}) ([]SliderRoute, error) {
+	entries, ok := value.([]interface{})
+	if !ok {
+		entries = []interface{}{value}
+	}
+
+	routes := []SliderRoute{}
+
+	for _, entry := range entries {
+		route := SliderRoute{}
+
+		switch entry := entry.(type) {
+		case string:
+			route.Sink = entry
+
+		case map[string]interface{}:
+			for key, setting := range entry {
+				switch key {
+				case sliderRouteKeySink:
+					route.Sink = fmt.Sprint(setting)
+				case sliderRouteKeyLabel:
+					route.Label = fmt.Sprint(setting)
+				default:
+					return nil, fmt.Errorf("unknown route setting %q", key)
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("expected a sink or a map with a sink and a label, got %T", entry)
+		}
+
+		route.Sink = strings.TrimSpace(route.Sink)
+		if route.Sink == "" {
+			return nil, fmt.Errorf("route %v has no sink", entry)
+		}
+
+		if route.Label == "" {
+			route.Label = route.Sink
+		}
+
+		routes = append(routes, route)
+	}
+
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("expected at least one sink")
+	}
+
+	return routes, nil
+}
+
+// populateSliderRoutesFromViper reads the sinks each of a device's sliders can send its apps to
+func populateSliderRoutesFromViper(logger *zap.SugaredLogger, v *viper.Viper) map[int][]SliderRoute {
+	sliderRoutes := make(map[int][]SliderRoute)
+
+	for sliderIdxStr, value := range v.GetStringMap(configKeySliderRoutes) {
+		sliderIdx, err := strconv.Atoi(sliderIdxStr)
+		if err != nil {
+			logger.Warnw("Invalid slider index in slider_routes", "index", sliderIdxStr, "error", err)
+			continue
+		}
+
+		routes, err := parseSliderRoutes(value)
+		if err != nil {
+			logger.Warnw("Invalid slider routes config, ignoring", "slider", sliderIdx, "error", err)
+			continue
+		}
+
+		sliderRoutes[sliderIdx] = routes
+		logger.Debugw("Set routes for slider", "slider", sliderIdx, "routes", routes)
+	}
+
+	return sliderRoutes
+}
+
+func (a appliedSliderRoutes) equal(other appliedSliderRoutes) bool {
+	return reflect.DeepEqual(a.routes, other.routes) && reflect.DeepEqual(a.targets, other.targets)
+}
+
+func (r SliderRoute) String() string {
+	return fmt.Sprintf("<%s (%s)>", r.Label, r.Sink)
+}
+
+// routedSliderName is what a routed slider's display shows: its name followed by where its apps are going
+func routedSliderName(name string, route SliderRoute) string {
+	if name != "" {
+		name += sliderRouteNameSeparator
+	}
+
+	name += route.Label
+
+	if runes := []rune(name); len(runes) > maxSliderNameLength {
+		name = string(runes[:maxSliderNameLength])
+	}
+
+	return name
+}
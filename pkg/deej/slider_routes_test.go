@@ -0,0 +1,106 @@
+package deej
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoutedSliderName(t *testing.T) {
+	tests := []struct {
+		name       string
+		sliderName string
+		route      SliderRoute
+		want       string
+	}{
+		{"name and label", "DISCORD", SliderRoute{Label: "HEADSET"}, "DISCORD>HEADSET"},
+		{"label only", "", SliderRoute{Label: "SPEAKERS"}, "SPEAKERS"},
+		{"truncated", "GAMES AND MUSIC", SliderRoute{Label: "SPEAKERS"}, "GAMES AND MUSIC>SPE"},
+		{"truncated by rune", "MÜSIK UND SPIELE", SliderRoute{Label: "KOPFHÖRER"}, "MÜSIK UND SPIELE>KO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routedSliderName(tt.sliderName, tt.route); got != tt.want {
+				t.Errorf("routedSliderName(%q, %v) = %q, want %q", tt.sliderName, tt.route, got, tt.want)
+			}
+		})
+	}
+}
+
+// routedTestSession is a test session that remembers where it was sent
+type routedTestSession struct {
+	*testSession
+	sinks []string
+}
+
+func (s *routedTestSession) moveToSink(sink string) error {
+	s.sinks = append(s.sinks, sink)
+	return nil
+}
+
+func TestApplySliderRoutes(t *testing.T) {
+	headset := SliderRoute{Sink: "headset", Label: "headset"}
+	speakers := SliderRoute{Sink: "speakers", Label: "speakers"}
+	tv := SliderRoute{Sink: "tv", Label: "tv"}
+
+	tests := []struct {
+		name   string
+		reload func(device *DeviceConfig)
+
+		wantSinks []string
+		wantRoute int
+	}{
+		{
+			name:      "unrelated reload",
+			reload:    func(device *DeviceConfig) { device.SliderNames = "MASTER|DISCORD" },
+			wantSinks: nil,
+			wantRoute: 1,
+		},
+		{
+			name:      "targets changed",
+			reload:    func(device *DeviceConfig) { device.SliderMapping.set(1, []string{"discord", "spotify"}) },
+			wantSinks: []string{"speakers"},
+			wantRoute: 1,
+		},
+		{
+			name:      "routes changed",
+			reload:    func(device *DeviceConfig) { device.SliderRoutes[1] = []SliderRoute{headset, tv} },
+			wantSinks: []string{"headset"},
+			wantRoute: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig(map[int][]string{1: {"discord"}})
+			device := config.Devices[0]
+			device.SliderRoutes[1] = []SliderRoute{headset, speakers}
+
+			m, _ := newTestSessionMap(t, config, nil)
+
+			discord := &routedTestSession{testSession: newTestSession("discord", nil)}
+			m.add(discord)
+
+			m.applySliderRoutes()
+			if want := []string{"headset"}; !reflect.DeepEqual(discord.sinks, want) {
+				t.Fatalf("applySliderRoutes() on startup sent discord to %v, want %v", discord.sinks, want)
+			}
+
+			// as if the slider's button was pressed
+			key := sliderRouteKey{device: device.Name, slider: 1}
+			m.routes[key] = 1
+			discord.sinks = nil
+
+			tt.reload(device)
+			m.applySliderRoutes()
+
+			if !reflect.DeepEqual(discord.sinks, tt.wantSinks) {
+				t.Errorf("applySliderRoutes() sent discord to %v, want %v", discord.sinks, tt.wantSinks)
+			}
+
+			if m.routes[key] != tt.wantRoute {
+				t.Errorf("applySliderRoutes() left the slider on route %d, want %d", m.routes[key], tt.wantRoute)
+			}
+		})
+	}
+}
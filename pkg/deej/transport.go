@@ -0,0 +1,280 @@
+package deej
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"go.bug.st/serial"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// Transport represents a bidirectional byte stream connection to a deej device.
+// SerialIO doesn't care whether the bytes come from a COM port, a socket or a script
+type Transport interface {
+	Open() error
+	Reader() *bufio.Reader
+	Write(data []byte) error
+	Close() error
+
+	String() string
+}
+
+const (
+	transportSerial = "serial" // a physical (or virtual) serial port, the default
+	transportPTY    = "pty"    // a pseudo-terminal created by deej, for feeding scripted input (Linux-only)
+	transportTCP    = "tcp"    // a TCP connection to a networked mixer or a test harness
+	transportStdin  = "stdin"  // deej's own stdin/stdout, for piping recorded or generated lines
+
+	tcpDialTimeout = 5 * time.Second
+)
+
+var errTransportClosed = errors.New("transport: not open")
+
+// newTransport selects a transport implementation according to the given connection info. expectedControls
+// is how many controls the device is configured to have, which helps tell it apart when looking for its port
+func newTransport(logger *zap.SugaredLogger, info ConnectionInfo, expectedControls int) (Transport, error) {
+	logger = logger.Named("transport")
+
+	switch info.Transport {
+	case transportSerial, "":
+		return &serialTransport{
+			logger:           logger,
+			comPort:          info.COMPort,
+			baudRate:         info.BaudRate,
+			usbIDs:           info.USBIDs,
+			expectedControls: expectedControls,
+		}, nil
+	case transportPTY:
+		return &ptyTransport{logger: logger, link: info.PTYLink}, nil
+	case transportTCP:
+		if info.TCPAddress == "" {
+			return nil, errors.New("transport: tcp transport requires an address")
+		}
+
+		return &tcpTransport{logger: logger, address: info.TCPAddress}, nil
+	case transportStdin:
+		return &stdinTransport{logger: logger}, nil
+	}
+
+	return nil, fmt.Errorf("transport: unknown transport type %q", info.Transport)
+}
+
+// byteStream implements the read/write/close parts of Transport on top of any byte stream,
+// which is all most transports need once they've established one
+type byteStream struct {
+	stream io.ReadWriteCloser
+	reader *bufio.Reader
+}
+
+func (bs *byteStream) attach(stream io.ReadWriteCloser) {
+	bs.stream = stream
+	bs.reader = bufio.NewReader(stream)
+}
+
+func (bs *byteStream) Reader() *bufio.Reader {
+	return bs.reader
+}
+
+func (bs *byteStream) Write(data []byte) error {
+	if bs.stream == nil {
+		return errTransportClosed
+	}
+
+	_, err := bs.stream.Write(data)
+	return err
+}
+
+func (bs *byteStream) Close() error {
+	if bs.stream == nil {
+		return errTransportClosed
+	}
+
+	err := bs.stream.Close()
+	bs.stream = nil
+	bs.reader = nil
+
+	return err
+}
+
+type serialTransport struct {
+	byteStream
+
+	logger   *zap.SugaredLogger
+	comPort  string
+	baudRate int
+	usbIDs   []string
+
+	// only used to recognize the device when comPort is "auto"
+	expectedControls int
+
+	// the port we actually opened, which is only different from comPort when that's "auto"
+	resolvedPort string
+}
+
+func (t *serialTransport) Open() error {
+	t.resolvedPort = t.comPort
+
+	if t.comPort == comPortAuto {
+		port, err := discoverSerialPort(t.logger, t.baudRate, t.usbIDs, t.expectedControls)
+		if err != nil {
+			return fmt.Errorf("discover serial port: %w", err)
+		}
+
+		t.resolvedPort = port
+	}
+
+	mode := &serial.Mode{
+		BaudRate: t.baudRate,
+		DataBits: 8,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	}
+
+	port, err := serial.Open(t.resolvedPort, mode)
+	if err != nil {
+		return fmt.Errorf("open serial port: %w", err)
+	}
+
+	t.attach(port)
+	t.logger.Debugw("Opened serial port", "comPort", t.resolvedPort, "baudRate", t.baudRate)
+
+	return nil
+}
+
+func (t *serialTransport) String() string {
+	port := t.resolvedPort
+	if port == "" {
+		port = t.comPort
+	}
+
+	return fmt.Sprintf("serial:%s@%d", port, t.baudRate)
+}
+
+type tcpTransport struct {
+	byteStream
+
+	logger  *zap.SugaredLogger
+	address string
+}
+
+func (t *tcpTransport) Open() error {
+	conn, err := net.DialTimeout("tcp", t.address, tcpDialTimeout)
+	if err != nil {
+		return fmt.Errorf("dial tcp transport: %w", err)
+	}
+
+	t.attach(conn)
+	t.logger.Debugw("Connected to TCP device", "address", t.address)
+
+	return nil
+}
+
+func (t *tcpTransport) String() string {
+	return fmt.Sprintf("tcp:%s", t.address)
+}
+
+// ptyTransport creates a pseudo-terminal and reads device lines from its master end.
+// anything that writes lines into the slave end (e.g. "echo '=|50|20' > /dev/pts/3") acts as the device
+type ptyTransport struct {
+	byteStream
+
+	logger *zap.SugaredLogger
+	link   string
+
+	slave *os.File
+}
+
+func (t *ptyTransport) Open() error {
+	master, slave, err := util.OpenPTY()
+	if err != nil {
+		return fmt.Errorf("open pty transport: %w", err)
+	}
+
+	// we keep our own handle on the slave end so that reads don't fail whenever no writer is attached.
+	// whatever we write to the master end (host messages) piles up on the slave end until someone reads it,
+	// and writes block once that buffer is full, so we read and discard it ourselves
+	t.slave = slave
+	t.attach(master)
+
+	go t.discardHostMessages(slave)
+
+	if t.link != "" {
+		os.Remove(t.link)
+
+		if err := os.Symlink(slave.Name(), t.link); err != nil {
+			t.logger.Warnw("Failed to link pty slave", "slave", slave.Name(), "link", t.link, "error", err)
+		}
+	}
+
+	t.logger.Infow("Created pty for device input", "slave", slave.Name(), "link", t.link)
+
+	return nil
+}
+
+// discardHostMessages drains the slave end until it's closed. the pty is only meant for feeding device lines,
+// so nothing else is expected to read host messages from it
+func (t *ptyTransport) discardHostMessages(slave *os.File) {
+	if _, err := io.Copy(io.Discard, slave); err != nil && !errors.Is(err, os.ErrClosed) {
+		t.logger.Debugw("Stopped draining pty slave", "error", err)
+	}
+}
+
+func (t *ptyTransport) Close() error {
+	if t.slave != nil {
+		t.slave.Close()
+		t.slave = nil
+	}
+
+	if t.link != "" {
+		os.Remove(t.link)
+	}
+
+	return t.byteStream.Close()
+}
+
+func (t *ptyTransport) String() string {
+	if t.slave == nil {
+		return transportPTY
+	}
+
+	return fmt.Sprintf("pty:%s", t.slave.Name())
+}
+
+// stdinTransport reads device lines from stdin and writes host messages to stdout, one per line.
+// closing it doesn't close either of them, since they aren't ours to close
+type stdinTransport struct {
+	byteStream
+
+	logger *zap.SugaredLogger
+}
+
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error)  { return os.Stdin.Read(p) }
+func (stdio) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+func (stdio) Close() error                { return nil }
+
+func (t *stdinTransport) Open() error {
+	t.attach(stdio{})
+	t.logger.Debug("Reading device lines from stdin")
+
+	return nil
+}
+
+func (t *stdinTransport) Write(data []byte) error {
+	line := make([]byte, 0, len(data)+1)
+	line = append(line, data...)
+
+	return t.byteStream.Write(append(line, '\n'))
+}
+
+func (t *stdinTransport) String() string {
+	return transportStdin
+}
@@ -1,6 +1,8 @@
 package deej
 
 import (
+	"fmt"
+
 	"github.com/getlantern/systray"
 
 	"github.com/omriharel/deej/pkg/deej/icon"
@@ -23,6 +25,19 @@ func (d *Deej) initializeTray(onDone func()) {
 		refreshSessions := systray.AddMenuItem("Re-scan audio sessions", "Manually refresh audio sessions if something's stuck")
 		refreshSessions.SetIcon(icon.RefreshSessions)
 
+		// one (disabled) item per device, showing what it's connected to
+		systray.AddSeparator()
+		for _, serial := range d.devices {
+			connectionInfo := systray.AddMenuItem(connectionMenuTitle(serial.DeviceName(), ""), "The device deej is currently connected to")
+			connectionInfo.Disable()
+
+			go func(serial *SerialIO) {
+				for connectionName := range serial.SubscribeToConnectionChanges() {
+					connectionInfo.SetTitle(connectionMenuTitle(serial.DeviceName(), connectionName))
+				}
+			}(serial)
+		}
+
 		if d.version != "" {
 			systray.AddSeparator()
 			versionInfo := systray.AddMenuItem(d.version, "")
@@ -80,6 +95,18 @@ func (d *Deej) initializeTray(onDone func()) {
 	systray.Run(onReady, onExit)
 }
 
+func connectionMenuTitle(deviceName string, connectionName string) string {
+	if connectionName == "" {
+		connectionName = "not connected"
+	}
+
+	if deviceName == defaultDeviceName {
+		return fmt.Sprintf("Device: %s", connectionName)
+	}
+
+	return fmt.Sprintf("Device %s: %s", deviceName, connectionName)
+}
+
 func (d *Deej) stopTray() {
 	d.logger.Debug("Quitting tray")
 	systray.Quit()
@@ -43,7 +43,7 @@ func Windows() bool {
 // SetupCloseHandler creates a 'listener' on a new goroutine which will notify the
 // program if it receives an interrupt from the OS
 func SetupCloseHandler() chan os.Signal {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	return c
@@ -51,11 +51,17 @@ func SetupCloseHandler() chan os.Signal {
 
 // GetCurrentWindowProcessNames returns the process names (including extension, if applicable)
 // of the current foreground window. This includes child processes belonging to the window.
-// This is currently only implemented for Windows
+// On Linux, this works under X11 (through xprop), sway, i3 and Hyprland
 func GetCurrentWindowProcessNames() ([]string, error) {
 	return getCurrentWindowProcessNames()
 }
 
+// OpenPTY creates a new pseudo-terminal pair with echo disabled, returning its master and slave ends.
+// Whatever gets written to one end can be read from the other. This is currently only implemented for Linux
+func OpenPTY() (*os.File, *os.File, error) {
+	return openPTY()
+}
+
 // OpenExternal spawns a detached window with the provided command and argument
 func OpenExternal(logger *zap.SugaredLogger, cmd string, arg string) error {
 
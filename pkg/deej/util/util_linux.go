@@ -1,9 +1,368 @@
 package util
 
 import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/go-ps"
+	"github.com/thoas/go-funk"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	getCurrentWindowInternalCooldown = time.Millisecond * 350
+
+	// how long we'll wait for the compositor (or xprop) to tell us which window is focused
+	getCurrentWindowTimeout = time.Millisecond * 250
+
+	// sway and i3 share an IPC protocol: a magic string, then the payload's length and the message type
+	// (both in native byte order), then the payload
+	i3IPCMagic          = "i3-ipc"
+	i3IPCMessageGetTree = 4
+)
+
+var (
+	lastGetCurrentWindowResult []string
+	lastGetCurrentWindowCall   = time.Now()
+
+	errNoWindowSystem = errors.New("no supported window system found")
+
+	// xprop output, e.g. "_NET_ACTIVE_WINDOW(WINDOW): window id # 0x3a00007" and "_NET_WM_PID(CARDINAL) = 4242"
+	xpropActiveWindowPattern = regexp.MustCompile(`window id # (0x[0-9a-fA-F]+)`)
+	xpropPIDPattern          = regexp.MustCompile(`= (\d+)`)
+
+	// processes that host other programs rather than play anything themselves (much like ApplicationFrameHost.exe
+	// on Windows), along with which of their descendants do the actual playing. nil stands for all of them.
+	// other processes' descendants aren't included, since for terminals and launchers that'd be everything they started.
+	// Windows goes by the focused window's child windows instead, which have no equivalent here. the docs for
+	// deej.current list these wrappers, so keep them in sync
+	wrapperProcessDescendants = map[string][]string{
+		"bwrap":                nil,
+		"pressure-vessel-wrap": nil,
+		"wine":                 nil,
+		"wine64":               nil,
+		"wine-preloader":       nil,
+		"wine64-preloader":     nil,
+		"steam":                {"steamwebhelper"},
+	}
 )
 
 func getCurrentWindowProcessNames() ([]string, error) {
-	return nil, errors.New("Not implemented")
+
+	// apply an internal cooldown on this function to avoid asking the compositor too frequently.
+	// return a cached value during that cooldown
+	now := time.Now()
+	if lastGetCurrentWindowCall.Add(getCurrentWindowInternalCooldown).After(now) {
+		return lastGetCurrentWindowResult, nil
+	}
+
+	lastGetCurrentWindowCall = now
+
+	pid, err := getFocusedWindowPID()
+	if err != nil {
+		return nil, fmt.Errorf("get focused window pid: %w", err)
+	}
+
+	// nothing's focused (or the focused window doesn't say who it belongs to)
+	if pid == 0 {
+		return nil, nil
+	}
+
+	process, err := ps.FindProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("get process for pid %d: %w", pid, err)
+	}
+
+	// it could've exited in the meantime
+	if process == nil {
+		return nil, nil
+	}
+
+	// much like on Windows, the focused window doesn't necessarily belong to the process that plays its audio.
+	// sandboxes and wrappers (flatpak, wine, steam) leave the actual playing to processes they spawn, so for those
+	// we also return the names of the processes that could be doing it
+	name := processName(process)
+	result := []string{name}
+
+	if playing, ok := wrapperProcessDescendants[name]; ok {
+		if processes, err := ps.Processes(); err == nil {
+			result = append(result, descendantProcessNames(pid, processes, playing)...)
+		}
+	}
+
+	// cache & return whichever executable names we ended up with
+	lastGetCurrentWindowResult = result
+	return result, nil
+}
+
+// getFocusedWindowPID asks whichever window system we're running under for the focused window's process ID.
+// Wayland compositors are asked first, since they also set DISPLAY for Xwayland
+func getFocusedWindowPID() (int, error) {
+	if socketPath := os.Getenv("SWAYSOCK"); socketPath != "" {
+		return getI3FocusedWindowPID(socketPath)
+	}
+
+	if socketPath := os.Getenv("I3SOCK"); socketPath != "" {
+		return getI3FocusedWindowPID(socketPath)
+	}
+
+	if signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE"); signature != "" {
+		return getHyprlandFocusedWindowPID(signature)
+	}
+
+	if os.Getenv("DISPLAY") != "" {
+		return getX11FocusedWindowPID()
+	}
+
+	return 0, errNoWindowSystem
+}
+
+type i3Node struct {
+	Focused       bool     `json:"focused"`
+	PID           int      `json:"pid"`
+	Nodes         []i3Node `json:"nodes"`
+	FloatingNodes []i3Node `json:"floating_nodes"`
+}
+
+// getI3FocusedWindowPID gets the layout tree over sway/i3 IPC and finds the focused node in it
+func getI3FocusedWindowPID(socketPath string) (int, error) {
+	conn, err := net.DialTimeout("unix", socketPath, getCurrentWindowTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("connect to i3 ipc socket: %w", err)
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(getCurrentWindowTimeout))
+
+	request := make([]byte, len(i3IPCMagic)+8)
+	copy(request, i3IPCMagic)
+	binary.NativeEndian.PutUint32(request[len(i3IPCMagic):], 0)
+	binary.NativeEndian.PutUint32(request[len(i3IPCMagic)+4:], i3IPCMessageGetTree)
+
+	if _, err := conn.Write(request); err != nil {
+		return 0, fmt.Errorf("send i3 ipc request: %w", err)
+	}
+
+	header := make([]byte, len(i3IPCMagic)+8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, fmt.Errorf("read i3 ipc reply header: %w", err)
+	}
+
+	if string(header[:len(i3IPCMagic)]) != i3IPCMagic {
+		return 0, errors.New("read i3 ipc reply header: bad magic")
+	}
+
+	payload := make([]byte, binary.NativeEndian.Uint32(header[len(i3IPCMagic):]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return 0, fmt.Errorf("read i3 ipc reply: %w", err)
+	}
+
+	tree := i3Node{}
+	if err := json.Unmarshal(payload, &tree); err != nil {
+		return 0, fmt.Errorf("parse i3 layout tree: %w", err)
+	}
+
+	return tree.focusedPID(), nil
+}
+
+func (n i3Node) focusedPID() int {
+	if n.Focused {
+		return n.PID
+	}
+
+	for _, children := range [][]i3Node{n.Nodes, n.FloatingNodes} {
+		for _, child := range children {
+			if pid := child.focusedPID(); pid != 0 {
+				return pid
+			}
+		}
+	}
+
+	return 0
+}
+
+// getHyprlandFocusedWindowPID asks Hyprland's request socket for the active window. the socket moved
+// from /tmp to the runtime directory at some point, so both places are tried
+func getHyprlandFocusedWindowPID(signature string) (int, error) {
+	socketPaths := []string{filepath.Join("/tmp", "hypr", signature, ".socket.sock")}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		socketPaths = append([]string{filepath.Join(runtimeDir, "hypr", signature, ".socket.sock")}, socketPaths...)
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	for _, socketPath := range socketPaths {
+		if conn, err = net.DialTimeout("unix", socketPath, getCurrentWindowTimeout); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("connect to hyprland socket: %w", err)
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(getCurrentWindowTimeout))
+
+	if _, err := conn.Write([]byte("j/activewindow")); err != nil {
+		return 0, fmt.Errorf("send hyprland request: %w", err)
+	}
+
+	// hyprland replies and closes the connection
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return 0, fmt.Errorf("read hyprland reply: %w", err)
+	}
+
+	window := struct {
+		PID int `json:"pid"`
+	}{}
+
+	if err := json.Unmarshal(reply, &window); err != nil {
+		return 0, fmt.Errorf("parse hyprland active window: %w", err)
+	}
+
+	// hyprland uses -1 for windows it doesn't know the process of
+	if window.PID < 0 {
+		return 0, nil
+	}
+
+	return window.PID, nil
+}
+
+// getX11FocusedWindowPID reads the root window's _NET_ACTIVE_WINDOW, and then that window's _NET_WM_PID
+func getX11FocusedWindowPID() (int, error) {
+	output, err := xprop("-root", "_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return 0, err
+	}
+
+	match := xpropActiveWindowPattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0, fmt.Errorf("parse active window from xprop output %q", output)
+	}
+
+	windowID, err := strconv.ParseUint(match[1], 0, 32)
+	if err != nil || windowID == 0 {
+		return 0, nil
+	}
+
+	output, err = xprop("-id", match[1], "_NET_WM_PID")
+	if err != nil {
+		return 0, err
+	}
+
+	// windows that don't set _NET_WM_PID aren't an error, we just can't tell who they belong to
+	match = xpropPIDPattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(match[1])
+}
+
+func xprop(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), getCurrentWindowTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "xprop", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("xprop %v: %w", args, err)
+	}
+
+	return string(output), nil
+}
+
+// processName prefers the name of the process's executable, which is what PulseAudio goes by
+// (the name in /proc/<pid>/stat is cut short at 15 characters)
+func processName(process ps.Process) string {
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", process.Pid())); err == nil {
+		return filepath.Base(exe)
+	}
+
+	return process.Executable()
+}
+
+// descendantProcessNames returns the names of a process's descendants, only including those with one of the
+// given names unless that's nil
+func descendantProcessNames(pid int, processes []ps.Process, only []string) []string {
+	children := map[int][]ps.Process{}
+	for _, process := range processes {
+		children[process.PPid()] = append(children[process.PPid()], process)
+	}
+
+	names := []string{}
+	pending := []int{pid}
+
+	for len(pending) > 0 {
+		parent := pending[0]
+		pending = pending[1:]
+
+		for _, child := range children[parent] {
+			pending = append(pending, child.Pid())
+
+			name := processName(child)
+			if only == nil || funk.ContainsString(only, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open pty master: %w", err)
+	}
+
+	fd := int(master.Fd())
+
+	// unlock the slave side and find out which one we got
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("unlock pty slave: %w", err)
+	}
+
+	ptyNumber, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("get pty slave number: %w", err)
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", ptyNumber), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("open pty slave: %w", err)
+	}
+
+	// whatever the master writes shouldn't be echoed back to it by the slave's line discipline
+	termios, err := unix.IoctlGetTermios(int(slave.Fd()), unix.TCGETS)
+	if err == nil {
+		termios.Lflag &^= unix.ECHO | unix.ECHONL
+		err = unix.IoctlSetTermios(int(slave.Fd()), unix.TCSETS, termios)
+	}
+
+	if err != nil {
+		slave.Close()
+		master.Close()
+		return nil, nil, fmt.Errorf("disable pty echo: %w", err)
+	}
+
+	return master, slave, nil
 }
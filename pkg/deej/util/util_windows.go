@@ -1,7 +1,9 @@
 package util
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"syscall"
 	"time"
 	"unsafe"
@@ -94,3 +96,7 @@ func getCurrentWindowProcessNames() ([]string, error) {
 	lastGetCurrentWindowResult = result
 	return result, nil
 }
+
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, errors.New("Not implemented")
+}
@@ -0,0 +1,310 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VolumeCurve maps a slider's position (0 to 1) to the volume it sets, between Min and Max (which a points curve's
+// volumes are scaled into too). encoder steps move the volume along the same curve, rather than by a fixed amount.
+// PulseAudio volumes (and PipeWire ones, which deej sets the same way) are the cube root of the gain they apply, so
+// the linear, cubic and log curves shape that gain, rather than the volume itself. windows session volumes are
+// treated the same way, which is only an approximation there. a points curve goes through the volumes as given
+type VolumeCurve struct {
+	Type string
+
+	Min float32
+	Max float32
+
+	// the volume range a "log" curve spans, in decibels
+	Range float32
+
+	// the positions and volumes (both 0 to 1) a "points" curve goes through, sorted by position
+	Points []VolumeCurvePoint
+}
+
+// VolumeCurvePoint is a single point a "points" curve goes through
+type VolumeCurvePoint struct {
+	Position float32
+	Volume   float32
+}
+
+const (
+	configKeySliderCurves = "slider_curves"
+
+	// keys within a single slider's curve config
+	volumeCurveKeyType   = "curve"
+	volumeCurveKeyMin    = "min"
+	volumeCurveKeyMax    = "max"
+	volumeCurveKeyRange  = "range"
+	volumeCurveKeyPoints = "points"
+
+	volumeCurveLinear = "linear"
+	volumeCurveLog    = "log"
+	volumeCurveCubic  = "cubic"
+	volumeCurvePoints = "points"
+
+	defaultVolumeCurveRange = 60
+
+	// the power that turns a PulseAudio or PipeWire volume into its gain (see VolumeCurve)
+	sessionVolumeExponent = 3
+
+	// how far past its min or max a volume can read back (after the audio server rounds it) and still be on a curve
+	volumeCurveTolerance = 0.005
+)
+
+// volumeCurveAliases are other names people might know the curve types by
+var volumeCurveAliases = map[string]string{
+	"db":          volumeCurveLog,
+	"logarithmic": volumeCurveLog,
+}
+
+// defaultVolumeCurve sets a session's volume in step with the slider, like the system's own volume sliders do
+func defaultVolumeCurve(maxVolume float32) VolumeCurve {
+	return VolumeCurve{
+		Type:  volumeCurveCubic,
+		Max:   maxVolume,
+		Range: defaultVolumeCurveRange,
+	}
+}
+
+// parseVolumeCurve reads a single slider's curve config, which is either the name of a curve type or a map of
+// curve settings. min, max and points are given in percent, like slider_max_volume. the fallback (a cubic
+// curve up to the slider's max volume) provides whatever isn't set
+func parseVolumeCurve(value interface{}, fallback VolumeCurve) (VolumeCurve, error) {
+	curve := fallback
+
+	if curveType, ok := value.(string); ok {
+		return curve, curve.setType(curveType)
+	}
+
+	settings, ok := value.(map[string]interface{})
+	if !ok {
+		return fallback, fmt.Errorf("expected a curve name or a map of curve settings, got %T", value)
+	}
+
+	for key, setting := range settings {
+		var err error
+
+		switch key {
+		case volumeCurveKeyType:
+			err = curve.setType(fmt.Sprint(setting))
+		case volumeCurveKeyMin:
+			curve.Min, err = parseVolumeCurvePercent(setting)
+		case volumeCurveKeyMax:
+			curve.Max, err = parseVolumeCurvePercent(setting)
+		case volumeCurveKeyRange:
+			var decibels float64
+			decibels, err = strconv.ParseFloat(fmt.Sprint(setting), 32)
+			if err == nil && decibels <= 0 {
+				err = fmt.Errorf("range must be positive, got %v", setting)
+			}
+			curve.Range = float32(decibels)
+		case volumeCurveKeyPoints:
+			curve.Type = volumeCurvePoints
+			curve.Points, err = parseVolumeCurvePoints(setting)
+		default:
+			err = fmt.Errorf("unknown curve setting %q", key)
+		}
+
+		if err != nil {
+			return fallback, err
+		}
+	}
+
+	if curve.Min > curve.Max {
+		return fallback, fmt.Errorf("min (%.0f%%) can't be above max (%.0f%%)", curve.Min*100, curve.Max*100)
+	}
+
+	if curve.Type == volumeCurvePoints && len(curve.Points) < 2 {
+		return fallback, fmt.Errorf("a points curve needs at least 2 points")
+	}
+
+	return curve, nil
+}
+
+func (vc *VolumeCurve) setType(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := volumeCurveAliases[name]; ok {
+		name = alias
+	}
+
+	switch name {
+	case volumeCurveLinear, volumeCurveLog, volumeCurveCubic, volumeCurvePoints:
+		vc.Type = name
+		return nil
+	}
+
+	return fmt.Errorf("unknown curve %q", name)
+}
+
+func parseVolumeCurvePercent(value interface{}) (float32, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(fmt.Sprint(value), "%"), 32)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("expected a percentage between 0 and 100, got %v", value)
+	}
+
+	return float32(percent / 100), nil
+}
+
+// parseVolumeCurvePoints reads a list of "position:volume" percentages, e.g. ["0:0", "50:20", "100:100"].
+// volumes can't go down as positions go up, otherwise encoder steps wouldn't know where they are on the curve
+func parseVolumeCurvePoints(value interface{}) ([]VolumeCurvePoint, error) {
+	entries, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list of points, got %T", value)
+	}
+
+	points := []VolumeCurvePoint{}
+
+	for _, entry := range entries {
+		position, volume, ok := strings.Cut(fmt.Sprint(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("expected a point like \"50:20\", got %v", entry)
+		}
+
+		point := VolumeCurvePoint{}
+		var err error
+
+		if point.Position, err = parseVolumeCurvePercent(strings.TrimSpace(position)); err != nil {
+			return nil, fmt.Errorf("point %v: %w", entry, err)
+		}
+
+		if point.Volume, err = parseVolumeCurvePercent(strings.TrimSpace(volume)); err != nil {
+			return nil, fmt.Errorf("point %v: %w", entry, err)
+		}
+
+		points = append(points, point)
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Position < points[j].Position })
+
+	for i := 1; i < len(points); i++ {
+		if points[i].Volume < points[i-1].Volume {
+			return nil, fmt.Errorf("volumes can't go down as positions go up (at %.0f%%)", points[i].Position*100)
+		}
+	}
+
+	return points, nil
+}
+
+func (vc VolumeCurve) String() string {
+	return fmt.Sprintf("<%s curve, %.0f%% to %.0f%%>", vc.Type, vc.Min*100, vc.Max*100)
+}
+
+// apply returns the volume for the given slider position
+func (vc VolumeCurve) apply(position float32) float32 {
+	position = clampUnit(position)
+
+	var loudness float64
+
+	switch vc.Type {
+	case volumeCurvePoints:
+		return vc.Min + (vc.Max-vc.Min)*interpolateVolumeCurvePoints(vc.Points, position, false)
+
+	case volumeCurveCubic:
+		loudness = math.Pow(float64(position), 3)
+
+	// 0 is still silent, rather than -Range dB
+	case volumeCurveLog:
+		if position > 0 {
+			loudness = math.Pow(10, float64(vc.Range)*(float64(position)-1)/20)
+		}
+
+	default:
+		loudness = float64(position)
+	}
+
+	minLoudness, maxLoudness := vc.loudnessRange()
+
+	return float32(math.Pow(minLoudness+(maxLoudness-minLoudness)*loudness, 1.0/sessionVolumeExponent))
+}
+
+// position returns the slider position that would have set the given volume
+func (vc VolumeCurve) position(volume float32) float32 {
+	if vc.Max <= vc.Min {
+		return 0
+	}
+
+	if vc.Type == volumeCurvePoints {
+		return interpolateVolumeCurvePoints(vc.Points, clampUnit((volume-vc.Min)/(vc.Max-vc.Min)), true)
+	}
+
+	minLoudness, maxLoudness := vc.loudnessRange()
+	loudness := math.Pow(float64(volume), sessionVolumeExponent)
+	loudness = float64(clampUnit(float32((loudness - minLoudness) / (maxLoudness - minLoudness))))
+
+	switch vc.Type {
+	case volumeCurveCubic:
+		return float32(math.Cbrt(loudness))
+
+	case volumeCurveLog:
+		if loudness <= 0 {
+			return 0
+		}
+
+		return clampUnit(float32(1 + 20*math.Log10(loudness)/float64(vc.Range)))
+	}
+
+	return float32(loudness)
+}
+
+// step moves the volume along the curve by the given slider distance, like an encoder step does. a volume that
+// isn't on the curve at all (set from elsewhere, below its min or above its max) is left where it is
+func (vc VolumeCurve) step(volume float32, delta float32) float32 {
+	if volume < vc.Min-volumeCurveTolerance || volume > vc.Max+volumeCurveTolerance {
+		return volume
+	}
+
+	return vc.apply(vc.position(volume) + delta)
+}
+
+// loudnessRange returns the loudness at the curve's min and max volumes
+func (vc VolumeCurve) loudnessRange() (float64, float64) {
+	return math.Pow(float64(vc.Min), sessionVolumeExponent), math.Pow(float64(vc.Max), sessionVolumeExponent)
+}
+
+// interpolateVolumeCurvePoints goes from position to volume, or from volume to position if inverse is set
+func interpolateVolumeCurvePoints(points []VolumeCurvePoint, value float32, inverse bool) float32 {
+	from := func(point VolumeCurvePoint) float32 { return point.Position }
+	to := func(point VolumeCurvePoint) float32 { return point.Volume }
+
+	if inverse {
+		from, to = to, from
+	}
+
+	if value <= from(points[0]) {
+		return to(points[0])
+	}
+
+	for i := 1; i < len(points); i++ {
+		start, end := points[i-1], points[i]
+
+		if value > from(end) {
+			continue
+		}
+
+		if from(end) == from(start) {
+			return to(start)
+		}
+
+		return to(start) + (to(end)-to(start))*(value-from(start))/(from(end)-from(start))
+	}
+
+	return to(points[len(points)-1])
+}
+
+func clampUnit(value float32) float32 {
+	if value < 0 {
+		return 0
+	}
+
+	if value > 1 {
+		return 1
+	}
+
+	return value
+}
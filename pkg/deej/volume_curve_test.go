@@ -0,0 +1,96 @@
+package deej
+
+import (
+	"math"
+	"testing"
+)
+
+const volumeCurveTestTolerance = 1e-4
+
+func TestVolumeCurveApply(t *testing.T) {
+	points := VolumeCurve{
+		Type:   volumeCurvePoints,
+		Max:    1,
+		Points: []VolumeCurvePoint{{0, 0}, {0.5, 0.2}, {1, 1}},
+	}
+
+	tests := []struct {
+		name     string
+		curve    VolumeCurve
+		position float32
+		want     float32
+	}{
+		{"default follows the slider", defaultVolumeCurve(1), 0.5, 0.5},
+		{"default up to its max volume", defaultVolumeCurve(0.8), 0.5, 0.4},
+		{"default clamps the position", defaultVolumeCurve(1), 1.2, 1},
+		{"cubic between min and max, bottom", VolumeCurve{Type: volumeCurveCubic, Min: 0.2, Max: 0.8}, 0, 0.2},
+		{"cubic between min and max, middle", VolumeCurve{Type: volumeCurveCubic, Min: 0.2, Max: 0.8}, 0.5, 0.41406},
+		{"cubic between min and max, top", VolumeCurve{Type: volumeCurveCubic, Min: 0.2, Max: 0.8}, 1, 0.8},
+		{"linear loudness", VolumeCurve{Type: volumeCurveLinear, Max: 1}, 0.125, 0.5},
+		{"log at the top", VolumeCurve{Type: volumeCurveLog, Max: 1, Range: 60}, 1, 1},
+		{"log halfway down its range", VolumeCurve{Type: volumeCurveLog, Max: 1, Range: 60}, 0.5, 0.31623},
+		{"log below its max volume", VolumeCurve{Type: volumeCurveLog, Max: 0.8, Range: 60}, 0.5, 0.25298},
+		{"log is silent at the bottom", VolumeCurve{Type: volumeCurveLog, Max: 1, Range: 60}, 0, 0},
+		{"points", points, 0.25, 0.1},
+		{"points, second segment", points, 0.75, 0.6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.curve.apply(tt.position); math.Abs(float64(got-tt.want)) > volumeCurveTestTolerance {
+				t.Errorf("%v.apply(%v) = %v, want %v", tt.curve, tt.position, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVolumeCurvePosition(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve VolumeCurve
+	}{
+		{"default", defaultVolumeCurve(0.8)},
+		{"cubic", VolumeCurve{Type: volumeCurveCubic, Min: 0.2, Max: 0.8}},
+		{"linear", VolumeCurve{Type: volumeCurveLinear, Min: 0.1, Max: 1}},
+		{"log", VolumeCurve{Type: volumeCurveLog, Max: 1, Range: 50}},
+		{"points", VolumeCurve{Type: volumeCurvePoints, Max: 1, Points: []VolumeCurvePoint{{0, 0}, {0.5, 0.2}, {1, 1}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, position := range []float32{0, 0.1, 0.25, 0.5, 0.9, 1} {
+				if got := tt.curve.position(tt.curve.apply(position)); math.Abs(float64(got-position)) > volumeCurveTestTolerance {
+					t.Errorf("%v.position(apply(%v)) = %v", tt.curve, position, got)
+				}
+			}
+		})
+	}
+}
+
+func TestVolumeCurveStep(t *testing.T) {
+	tests := []struct {
+		name   string
+		curve  VolumeCurve
+		volume float32
+		delta  float32
+		want   float32
+	}{
+		{"up", defaultVolumeCurve(1), 0.5, 0.1, 0.6},
+		{"down", defaultVolumeCurve(1), 0.5, -0.1, 0.4},
+		{"stops at the top", defaultVolumeCurve(1), 0.95, 0.1, 1},
+		{"stops at the bottom", defaultVolumeCurve(1), 0.05, -0.1, 0},
+		{"along a log curve", VolumeCurve{Type: volumeCurveLog, Max: 1, Range: 60}, 0.31623, 0.5, 1},
+		{"above max is left alone going up", defaultVolumeCurve(0.5), 0.8, 0.01, 0.8},
+		{"above max is left alone going down", defaultVolumeCurve(0.5), 0.8, -0.01, 0.8},
+		{"below min is left alone", VolumeCurve{Type: volumeCurveCubic, Min: 0.2, Max: 1}, 0.1, 0.01, 0.1},
+		{"rounding past max is still on the curve", defaultVolumeCurve(0.5), 0.503, -0.1, 0.45},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.curve.step(tt.volume, tt.delta); math.Abs(float64(got-tt.want)) > volumeCurveTestTolerance {
+				t.Errorf("%v.step(%v, %v) = %v, want %v", tt.curve, tt.volume, tt.delta, got, tt.want)
+			}
+		})
+	}
+}